@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// applyManifests applies the manifest files with a single kubectl apply,
+// retrying on transient errors, and recreating objects with immutable field
+// changes or reporting server-side apply conflicts if configured.
+func applyManifests(runner *Environ, vargs GKE, paths []string) error {
+	applyArgs := append([]string{"apply"}, applyFlags(vargs)...)
+	if vargs.ManifestDir != "" {
+		applyArgs = append(applyArgs, "--recursive")
+	}
+	if vargs.Prune {
+		applyArgs = append(applyArgs, pruneArgs(vargs)...)
+	}
+	applyArgs = append(applyArgs, "--filename", strings.Join(paths, ","))
+
+	applyOutput, err := runRetrying(runner, vargs, applyArgs...)
+	if err != nil && vargs.ReportConflicts && isConflict(applyOutput) {
+		if rerr := reportConflicts(runner, vargs, paths); rerr != nil {
+			runner.Printf("Warning: error checking field ownership conflicts: %s\n", rerr)
+		}
+		return err
+	}
+
+	if err != nil && vargs.RecreateOnImmutable {
+		objs := immutableObjects(applyOutput)
+		if len(objs) == 0 {
+			return err
+		}
+
+		var manifests []string
+		manifests, err = manifestFiles(vargs, paths)
+		if err != nil {
+			return err
+		}
+
+		err = recreateImmutable(runner, vargs, objs, manifests)
+		if err != nil {
+			return err
+		}
+
+		// Apply again, now that the recreated objects have been replaced.
+		_, err = runRetrying(runner, vargs, applyArgs...)
+	}
+
+	return err
+}
+
+// applyInOrder applies each group of files in turn, replacing those in
+// replaced instead, and records each in res. It stops at the first failure,
+// unless vargs.ContinueOnError is set, in which case it applies the rest and
+// then returns an error listing every failure.
+func applyInOrder(runner *Environ, vargs GKE, groups [][]string, replaced map[string]bool, res *result) error {
+	failures := []string{}
+	for _, paths := range groups {
+		var err error
+		if replaced[paths[0]] {
+			err = replaceManifest(runner, vargs, paths[0])
+		} else {
+			err = applyManifests(runner, vargs, paths)
+		}
+		res.record("apply", vargs.Cluster, err)
+		if err != nil {
+			if !vargs.ContinueOnError {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+
+			runner.Printf("Warning: applying %s failed, continuing: %s\n", strings.Join(paths, ","), err)
+			failures = append(failures, fmt.Sprintf("%s: %s", strings.Join(paths, ","), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Error: %d of %d files failed to apply:\n  %s\n", len(failures), len(groups), strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
+
+// applyFlags returns the kubectl apply flags that change how objects are
+// merged, for both real and dry run applies.
+func applyFlags(vargs GKE) []string {
+	flags := []string{}
+	if vargs.ServerSide {
+		flags = append(flags, "--server-side")
+	}
+	if vargs.Overwrite != nil && !*vargs.Overwrite {
+		flags = append(flags, "--overwrite=false")
+	}
+	return flags
+}
+
+// readApplyOrder reads the apply order file, which lists a template or
+// output path per line. Blank lines and lines starting with # are ignored.
+func readApplyOrder(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	order := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		order = append(order, line)
+	}
+
+	return order, scanner.Err()
+}
+
+// orderPaths returns the output paths in the given order, where each entry is
+// a template (a key of outPaths) or an output path. Output paths that aren't
+// listed follow in their original order, unless strict is set.
+func orderPaths(order []string, outPaths map[string]string, paths []string, strict bool) ([]string, error) {
+	isPath := map[string]bool{}
+	for _, p := range paths {
+		isPath[p] = true
+	}
+
+	ordered := []string{}
+	listed := map[string]bool{}
+	for _, entry := range order {
+		p, ok := outPaths[entry]
+		if !ok {
+			p = filepath.Clean(entry)
+		}
+
+		if !isPath[p] {
+			return nil, fmt.Errorf("Error: apply_order_file entry %q is not a rendered template\n", entry)
+		}
+
+		if listed[p] {
+			return nil, fmt.Errorf("Error: apply_order_file lists %q more than once\n", entry)
+		}
+
+		listed[p] = true
+		ordered = append(ordered, p)
+	}
+
+	for _, p := range paths {
+		if listed[p] {
+			continue
+		}
+
+		if strict {
+			return nil, fmt.Errorf("Error: %s is not listed in apply_order_file\n", p)
+		}
+
+		ordered = append(ordered, p)
+	}
+
+	return ordered, nil
+}
+
+// applyResultRegexp matches kubectl's report of what it did to an object.
+var applyResultRegexp = regexp.MustCompile(`(?m)^\S+ (created|configured|unchanged|pruned|replaced|serverside-applied)$`)
+
+// applyChanged reports whether the kubectl apply (or replace) output shows
+// any object changing, and whether that can be told from the output at all.
+// Server-side applies report every object as applied, changed or not.
+func applyChanged(output string) (bool, bool) {
+	changed, known := false, false
+	for _, m := range applyResultRegexp.FindAllStringSubmatch(output, -1) {
+		switch m[1] {
+		case "serverside-applied":
+			return false, false
+		case "unchanged":
+		default:
+			changed = true
+		}
+		known = true
+	}
+	return changed, known
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadApplyOrder(t *testing.T) {
+	f, err := ioutil.TempFile("", "order")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("# CRDs first.\ncrds.yml\n\n  .kube.yml  \n")
+	f.Close()
+
+	order, err := readApplyOrder(f.Name())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"crds.yml", ".kube.yml"}, order)
+	}
+}
+
+func TestOrderPaths(t *testing.T) {
+	outPaths := map[string]string{
+		".kube.yml":     "/tmp/.kube.yml",
+		".kube.sec.yml": "/tmp/.kube.sec.yml",
+		"crds.yml":      "/tmp/crds.yml",
+	}
+	paths := []string{"/tmp/.kube.yml", "/tmp/.kube.sec.yml", "/tmp/crds.yml"}
+
+	ordered, err := orderPaths([]string{"crds.yml", "/tmp/.kube.sec.yml"}, outPaths, paths, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"/tmp/crds.yml", "/tmp/.kube.sec.yml", "/tmp/.kube.yml"}, ordered)
+	}
+
+	_, err = orderPaths([]string{"crds.yml", "/tmp/.kube.sec.yml"}, outPaths, paths, true)
+	assert.Error(t, err)
+
+	_, err = orderPaths([]string{"other.yml"}, outPaths, paths, false)
+	assert.Error(t, err)
+
+	_, err = orderPaths([]string{"crds.yml", "/tmp/crds.yml"}, outPaths, paths, false)
+	assert.Error(t, err)
+}
+
+func TestApplyFlags(t *testing.T) {
+	assert.Equal(t, []string{}, applyFlags(GKE{}))
+
+	overwrite := true
+	assert.Equal(t, []string{"--server-side"}, applyFlags(GKE{ServerSide: true, Overwrite: &overwrite}))
+
+	overwrite = false
+	assert.Equal(t, []string{"--overwrite=false"}, applyFlags(GKE{Overwrite: &overwrite}))
+}
+
+func TestApplyChanged(t *testing.T) {
+	changed, known := applyChanged("deployment.apps/web unchanged\nservice/web unchanged\n")
+	assert.False(t, changed)
+	assert.True(t, known)
+
+	changed, known = applyChanged("deployment.apps/web configured\nservice/web unchanged\n")
+	assert.True(t, changed)
+	assert.True(t, known)
+
+	changed, known = applyChanged("service/web unchanged\nconfigmap/old pruned\n")
+	assert.True(t, changed)
+	assert.True(t, known)
+
+	changed, known = applyChanged("deployment.apps/web serverside-applied\n")
+	assert.False(t, changed)
+	assert.False(t, known)
+
+	_, known = applyChanged("")
+	assert.False(t, known)
+}
+
+func TestApplyManifestsRecreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apply")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := filepath.Join(dir, "job.yml")
+	err = ioutil.WriteFile(manifest, []byte("kind: Job\nmetadata:\n  name: migrate\n"), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The first apply fails with an immutable field change, and the rest
+	// succeed unless the re-apply is told to fail.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+cd "$(dirname "$0")"
+case "$1" in
+replace) exit 0 ;;
+esac
+if [ ! -e applied ]; then
+	touch applied
+	echo 'The Job "migrate" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable' >&2
+	exit 1
+fi
+[ ! -e fail ]
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(&bytes.Buffer{})
+	vargs := GKE{KubectlCmd: script, RecreateOnImmutable: true, RecreateKinds: []string{"Job"}}
+
+	assert.NoError(t, applyManifests(runner, vargs, []string{manifest}))
+
+	// A failed re-apply fails the build.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "applied")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fail"), nil, 0644))
+	assert.Error(t, applyManifests(runner, vargs, []string{manifest}))
+}
+
+func TestApplyInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apply")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Files named bad-* fail to apply.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+case "$*" in
+*bad-*) exit 1 ;;
+esac
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	log := &bytes.Buffer{}
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(log)
+	vargs := GKE{KubectlCmd: script, ContinueOnError: true}
+	groups := [][]string{{"bad-a.yml"}, {"b.yml"}, {"bad-c.yml"}, {"d.yml"}}
+
+	res := &result{}
+	err = applyInOrder(runner, vargs, groups, map[string]bool{}, res)
+	assert.EqualError(t, err, "Error: 2 of 4 files failed to apply:\n  bad-a.yml: exit status 1\n  bad-c.yml: exit status 1\n")
+	assert.Contains(t, log.String(), "--filename d.yml")
+	assert.Len(t, res.Phases, 4)
+
+	assert.NoError(t, applyInOrder(runner, vargs, [][]string{{"b.yml"}, {"d.yml"}}, map[string]bool{}, &result{}))
+
+	// Without continue_on_error, the first failure stops the apply.
+	log.Reset()
+	vargs.ContinueOnError = false
+	err = applyInOrder(runner, vargs, groups, map[string]bool{}, &result{})
+	assert.EqualError(t, err, "Error: exit status 1\n")
+	assert.NotContains(t, log.String(), "b.yml")
+}
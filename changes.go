@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// changes lists the objects a deploy adds, removes and keeps, by name.
+type changes struct {
+	Added   []string
+	Removed []string
+	Kept    []string
+}
+
+// compareNames compares the live object names with those proposed by a dry
+// run apply.
+func compareNames(live, proposed []string) changes {
+	c := changes{Added: []string{}, Removed: []string{}, Kept: []string{}}
+
+	isLive := map[string]bool{}
+	for _, n := range live {
+		isLive[n] = true
+	}
+
+	isProposed := map[string]bool{}
+	for _, n := range proposed {
+		if isProposed[n] {
+			continue
+		}
+		isProposed[n] = true
+
+		if isLive[n] {
+			c.Kept = append(c.Kept, n)
+		} else {
+			c.Added = append(c.Added, n)
+		}
+	}
+
+	for _, n := range live {
+		if !isProposed[n] {
+			c.Removed = append(c.Removed, n)
+		}
+	}
+
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Kept)
+	return c
+}
+
+// objectNames runs kubectl with `--output name` and returns the names it prints.
+func objectNames(runner *Environ, vargs GKE, args ...string) ([]string, error) {
+	out := &bytes.Buffer{}
+	args = append(args, "--output", "name")
+
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// changedObjects compares the live objects with prune_label, of the kinds in
+// the documents, with the objects a server-side dry run apply of the paths
+// would leave.
+func changedObjects(runner *Environ, vargs GKE, docs []document, paths []string) (changes, error) {
+	kinds := []string{}
+	seen := map[string]bool{}
+	for _, d := range docs {
+		k := strings.ToLower(d.Kind)
+		if k != "" && !seen[k] {
+			seen[k] = true
+			kinds = append(kinds, k)
+		}
+	}
+
+	nsArgs := []string{}
+	if vargs.Namespace != "" {
+		nsArgs = append(nsArgs, "--namespace", vargs.Namespace)
+	}
+
+	getArgs := append([]string{"get", strings.Join(kinds, ","), "--ignore-not-found", "--selector", vargs.PruneLabel}, nsArgs...)
+	live, err := objectNames(runner, vargs, getArgs...)
+	if err != nil {
+		return changes{}, err
+	}
+
+	applyArgs := append(append([]string{"apply", "--dry-run=server"}, applyFlags(vargs)...), nsArgs...)
+	if vargs.ManifestDir != "" {
+		applyArgs = append(applyArgs, "--recursive")
+	}
+	applyArgs = append(applyArgs, "--filename", strings.Join(paths, ","))
+
+	proposed, err := objectNames(runner, vargs, applyArgs...)
+	if err != nil {
+		return changes{}, err
+	}
+
+	return compareNames(live, proposed), nil
+}
+
+// printChanges prints the objects added, removed and kept.
+func printChanges(runner *Environ, c changes) {
+	runner.Printf("Changed objects: %d added, %d removed, %d kept\n", len(c.Added), len(c.Removed), len(c.Kept))
+	for _, n := range c.Added {
+		runner.Printf("  + %s\n", n)
+	}
+	for _, n := range c.Removed {
+		runner.Printf("  - %s\n", n)
+	}
+	for _, n := range c.Kept {
+		runner.Printf("    %s\n", n)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareNames(t *testing.T) {
+	c := compareNames(
+		[]string{"service/web", "deployment.apps/web", "configmap/old"},
+		[]string{"deployment.apps/web", "service/web", "deployment.apps/worker", "deployment.apps/worker"},
+	)
+
+	assert.Equal(t, []string{"deployment.apps/worker"}, c.Added)
+	assert.Equal(t, []string{"configmap/old"}, c.Removed)
+	assert.Equal(t, []string{"deployment.apps/web", "service/web"}, c.Kept)
+
+	c = compareNames(nil, nil)
+	assert.Equal(t, changes{Added: []string{}, Removed: []string{}, Kept: []string{}}, c)
+}
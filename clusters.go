@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// splitList splits a comma-separated list, trimming whitespace around each entry.
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+
+	l := strings.Split(s, ",")
+	for i := range l {
+		l[i] = strings.TrimSpace(l[i])
+	}
+
+	return l
+}
+
+// clusterNamespaces returns the namespace for each of the clusters. The
+// namespace param is either a single namespace for all of the clusters, or a
+// comma-separated list with one namespace per cluster.
+func clusterNamespaces(clusters []string, namespace string) ([]string, error) {
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("Missing required param: cluster")
+	}
+
+	for _, c := range clusters {
+		if c == "" {
+			return nil, fmt.Errorf("Error: cluster list %q contains an empty name\n", strings.Join(clusters, ","))
+		}
+	}
+
+	namespaces := splitList(namespace)
+
+	switch len(namespaces) {
+	case 0, 1:
+		ns := strings.TrimSpace(namespace)
+		namespaces = make([]string, len(clusters))
+		for i := range namespaces {
+			namespaces[i] = ns
+		}
+	case len(clusters):
+		for _, ns := range namespaces {
+			if ns == "" {
+				return nil, fmt.Errorf("Error: namespace list %q contains an empty name\n", namespace)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Error: namespace list has %d entries, but there are %d clusters\n", len(namespaces), len(clusters))
+	}
+
+	return namespaces, nil
+}
+
+// kubeconfigPath returns the path of the kubeconfig file for the i-th cluster.
+func kubeconfigPath(i int, cluster string) string {
+	return fmt.Sprintf("/tmp/kubeconfig-%d-%s", i, cluster)
+}
+
+// uniqueName appends the build number to the name of a kubeconfig file or
+// context, so concurrent builds on the same runner don't share it.
+func uniqueName(name string, build int) string {
+	return fmt.Sprintf("%s-%d", name, build)
+}
+
+// removeKubeconfig removes a cluster's kubeconfig file, warning if it can't.
+func removeKubeconfig(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: error removing kubeconfig file: %s\n", err)
+	}
+}
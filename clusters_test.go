@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitList(t *testing.T) {
+	assert.Nil(t, splitList(""))
+	assert.Nil(t, splitList("  "))
+	assert.Equal(t, []string{"a"}, splitList("a"))
+	assert.Equal(t, []string{"a", "b", ""}, splitList("a, b ,"))
+}
+
+func TestClusterNamespaces(t *testing.T) {
+	ns, err := clusterNamespaces([]string{"a"}, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{""}, ns)
+	}
+
+	ns, err = clusterNamespaces([]string{"a", "b"}, "prod")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"prod", "prod"}, ns)
+	}
+
+	ns, err = clusterNamespaces([]string{"a", "b"}, "prod-a, prod-b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"prod-a", "prod-b"}, ns)
+	}
+
+	_, err = clusterNamespaces([]string{"a", "b"}, "x,y,z")
+	assert.Error(t, err)
+
+	_, err = clusterNamespaces([]string{"a", "b"}, "x,")
+	assert.Error(t, err)
+
+	_, err = clusterNamespaces([]string{"a", ""}, "x")
+	assert.Error(t, err)
+
+	_, err = clusterNamespaces(nil, "x")
+	assert.Error(t, err)
+}
+
+func TestKubeconfigPath(t *testing.T) {
+	assert.Equal(t, "/tmp/kubeconfig-0-dev", kubeconfigPath(0, "dev"))
+	assert.Equal(t, "/tmp/kubeconfig-1-dev", kubeconfigPath(1, "dev"))
+}
+
+func TestUniqueName(t *testing.T) {
+	assert.Equal(t, "/tmp/kubeconfig-0-dev-42", uniqueName(kubeconfigPath(0, "dev"), 42))
+	assert.Equal(t, "gke_p_us-east1-b_dev-42", uniqueName("gke_p_us-east1-b_dev", 42))
+}
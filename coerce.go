@@ -0,0 +1,52 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	intPattern   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	floatPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+)
+
+// coerceVars returns the vars with strings that look like booleans or
+// numbers converted to them, including in nested maps and lists. Whole
+// numbers become int64, like those decoded from vars (see decodeVargs), so
+// they render as written and templates can compare them with eq.
+func coerceVars(vars map[string]interface{}) map[string]interface{} {
+	coerced := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		coerced[k] = coerceValue(v)
+	}
+	return coerced
+}
+
+func coerceValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return coerceVars(v)
+	case []interface{}:
+		coerced := make([]interface{}, len(v))
+		for i, e := range v {
+			coerced[i] = coerceValue(e)
+		}
+		return coerced
+	case string:
+		switch {
+		case v == "true":
+			return true
+		case v == "false":
+			return false
+		case intPattern.MatchString(v):
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+		case floatPattern.MatchString(v):
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return v
+}
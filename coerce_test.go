@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoerceVars(t *testing.T) {
+	coerced := coerceVars(map[string]interface{}{
+		"enabled":  "false",
+		"debug":    "true",
+		"replicas": "3",
+		"offset":   "-1",
+		"huge":     "12345678901234567890",
+		"ratio":    "0.5",
+		"mode":     "0755",
+		"version":  "v1.2.3",
+		"title":    "True",
+		"already":  false,
+		"nested": map[string]interface{}{
+			"enabled": "true",
+			"ports":   []interface{}{"80", "http"},
+		},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"enabled":  false,
+		"debug":    true,
+		"replicas": int64(3),
+		"offset":   int64(-1),
+		"huge":     "12345678901234567890",
+		"ratio":    0.5,
+		"mode":     "0755",
+		"version":  "v1.2.3",
+		"title":    "True",
+		"already":  false,
+		"nested": map[string]interface{}{
+			"enabled": true,
+			"ports":   []interface{}{int64(80), "http"},
+		},
+	}, coerced)
+}
+
+func TestCoerceVarsCompareJSON(t *testing.T) {
+	vargs, err := parseVargs(json.RawMessage(`{"vars": {"replicas": 3, "ratio": 0.5, "max": 1000000}}`), "/tmp")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	coerced := coerceVars(map[string]interface{}{"replicas": "3", "ratio": "0.5", "max": "1000000"})
+	data := map[string]interface{}{"json": vargs.Vars, "coerced": coerced}
+
+	tmpl := template.Must(template.New("eq").Option("missingkey=error").Parse(
+		`{{ eq .json.replicas .coerced.replicas }} {{ eq .json.ratio .coerced.ratio }} {{ .coerced.max }} {{ .json.max }}`))
+
+	b := &bytes.Buffer{}
+	if assert.NoError(t, tmpl.Execute(b, data)) {
+		assert.Equal(t, "true true 1000000 1000000", b.String())
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io"
+	"regexp"
+)
+
+// noColorEnv disables color output from gcloud and other tools that honor NO_COLOR.
+var noColorEnv = []string{
+	"CLOUDSDK_CORE_DISABLE_COLOR=true",
+	"NO_COLOR=1",
+	"TERM=dumb",
+}
+
+// ansiPattern matches ANSI escape sequences, e.g. color codes.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// stripANSI removes ANSI escape sequences from b.
+func stripANSI(b []byte) []byte {
+	return ansiPattern.ReplaceAll(b, nil)
+}
+
+// ansiStripper is a writer that removes ANSI escape sequences from what's
+// written to it.
+type ansiStripper struct {
+	w io.Writer
+}
+
+func (s ansiStripper) Write(p []byte) (int, error) {
+	_, err := s.w.Write(stripANSI(p))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
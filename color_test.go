@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripANSI(t *testing.T) {
+	assert.Equal(t, "deployment.apps/app configured", string(stripANSI([]byte("\x1b[32mdeployment.apps/app\x1b[0m configured"))))
+	assert.Equal(t, "no color", string(stripANSI([]byte("no color"))))
+}
+
+func TestEnvironRunNoColor(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	e := NewEnviron("/tmp", []string{}, stdout, &bytes.Buffer{})
+	e.noColor = true
+
+	err := e.Run("/usr/bin/printf", `\033[1;31mred\033[0m`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "red", stdout.String())
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// parseVargs decodes the plugin's vargs. If they name a config file (relative
+// to dir), its values are used as defaults for any vargs that aren't set.
+func parseVargs(raw json.RawMessage, dir string) (GKE, error) {
+	vargs := GKE{}
+	if len(raw) == 0 {
+		return vargs, nil
+	}
+
+	err := decodeVargs(raw, &vargs)
+	if err != nil {
+		return vargs, fmt.Errorf("Error parsing vargs: %s\n", err)
+	}
+
+	if vargs.Config == "" {
+		return vargs, nil
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(dir, vargs.Config))
+	if err != nil {
+		return vargs, fmt.Errorf("Error reading config file: %s\n", err)
+	}
+
+	// YAML is a superset of JSON, so this handles both.
+	var config interface{}
+	err = yaml.Unmarshal(blob, &config)
+	if err != nil {
+		return vargs, fmt.Errorf("Error parsing config file: %s\n", err)
+	}
+
+	blob, err = json.Marshal(normalizeYAML(config))
+	if err != nil {
+		return vargs, fmt.Errorf("Error parsing config file: %s\n", err)
+	}
+
+	// Decode the config file first, then the vargs over the top of it.
+	merged := GKE{}
+	err = decodeVargs(blob, &merged)
+	if err != nil {
+		return vargs, fmt.Errorf("Error parsing config file: %s\n", err)
+	}
+
+	err = decodeVargs(raw, &merged)
+	if err != nil {
+		return vargs, fmt.Errorf("Error parsing vargs: %s\n", err)
+	}
+
+	return merged, nil
+}
+
+// decodeVargs decodes blob over vargs. Whole numbers in vars and
+// vars_defaults become int64 rather than float64, so they render as written
+// (1000000, not 1e+06) and compare with eq like YAML and coerced numbers.
+func decodeVargs(blob []byte, vargs *GKE) error {
+	d := json.NewDecoder(bytes.NewReader(blob))
+	d.UseNumber()
+	if err := d.Decode(vargs); err != nil {
+		return err
+	}
+
+	vargs.Vars = decodeNumbers(vargs.Vars)
+	vargs.VarsDefaults = decodeNumbers(vargs.VarsDefaults)
+	return nil
+}
+
+// decodeNumbers returns m with its json.Number values, including in nested
+// maps and lists, converted to int64 if they're whole numbers, or float64.
+func decodeNumbers(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	decoded := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		decoded[k] = decodeNumber(v)
+	}
+	return decoded
+}
+
+func decodeNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return decodeNumbers(v)
+	case []interface{}:
+		decoded := make([]interface{}, len(v))
+		for i, e := range v {
+			decoded[i] = decodeNumber(e)
+		}
+		return decoded
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return v
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values produced by
+// the YAML decoder into map[string]interface{}, as the JSON decoder would.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = normalizeYAML(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVargs(t *testing.T) {
+	vargs, err := parseVargs(json.RawMessage(`{"zone": "us-east1-b", "vars": {"app": "a"}}`), "/tmp")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us-east1-b", vargs.Zone)
+		assert.Equal(t, map[string]interface{}{"app": "a"}, vargs.Vars)
+	}
+
+	vargs, err = parseVargs(nil, "/tmp")
+	if assert.NoError(t, err) {
+		assert.Equal(t, GKE{}, vargs)
+	}
+}
+
+func TestParseVargsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "gke.yml"), []byte(`
+zone: us-east1-b
+cluster: from-config
+vars:
+  app: my-app
+  replicas: 3
+  ports:
+    - name: http
+      port: 80
+`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	raw := json.RawMessage(`{"config": "gke.yml", "cluster": "from-vargs", "vars": {"env": "prod"}}`)
+	vargs, err := parseVargs(raw, dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us-east1-b", vargs.Zone)
+		assert.Equal(t, "from-vargs", vargs.Cluster)
+		assert.Equal(t, map[string]interface{}{
+			"app":      "my-app",
+			"replicas": int64(3),
+			"env":      "prod",
+			"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": int64(80)},
+			},
+		}, vargs.Vars)
+	}
+
+	_, err = parseVargs(json.RawMessage(`{"config": "missing.yml"}`), dir)
+	assert.Error(t, err)
+}
+
+func TestParseVargsListVars(t *testing.T) {
+	raw := json.RawMessage(`{"vars": {"app": "report", "jobs": [
+		{"name": "daily", "schedule": "0 4 * * *"},
+		{"name": "weekly", "schedule": "0 4 * * 0", "suspend": true}
+	]}}`)
+	vargs, err := parseVargs(raw, "/tmp")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	jobs, ok := vargs.Vars["jobs"].([]interface{})
+	if assert.True(t, ok) {
+		assert.IsType(t, map[string]interface{}{}, jobs[0])
+	}
+
+	// Inside range, fields are looked up on the element, top-level vars through $,
+	// and optional fields with index, which doesn't trip missingkey=error.
+	tmpl := template.Must(template.New("cronjobs").Option("missingkey=error").Parse(
+		`{{ range .jobs }}{{ $.app }}-{{ .name }}: {{ .schedule }} {{ index . "suspend" | printf "%v" }}
+{{ end }}`))
+
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, vargs.Vars)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "report-daily: 0 4 * * * <nil>\nreport-weekly: 0 4 * * 0 true\n", b.String())
+	}
+
+	tmpl = template.Must(template.New("cronjobs").Option("missingkey=error").Parse(`{{ range .jobs }}{{ .suspend }}{{ end }}`))
+	assert.Error(t, tmpl.Execute(&bytes.Buffer{}, vargs.Vars))
+}
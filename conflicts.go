@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// conflictPattern matches a server-side apply conflict with a field manager,
+	// followed by the field if there's only one.
+	conflictPattern = regexp.MustCompile(`conflicts? with "([^"]+)"(?: using [^:\s]+)?:(.*)$`)
+
+	// conflictFieldPattern matches a field in a list of conflicts.
+	conflictFieldPattern = regexp.MustCompile(`^\s*-\s+(\S+)`)
+)
+
+// isConflict reports whether kubectl's output contains a server-side apply conflict.
+func isConflict(output string) bool {
+	return strings.Contains(output, "Apply failed with") && strings.Contains(output, "conflict")
+}
+
+// parseConflicts returns the conflicting fields in kubectl's output, by the
+// field manager that owns them.
+func parseConflicts(output string) map[string][]string {
+	conflicts := map[string][]string{}
+
+	manager := ""
+	for _, line := range strings.Split(output, "\n") {
+		if m := conflictPattern.FindStringSubmatch(line); m != nil {
+			manager = m[1]
+			if field := strings.TrimSpace(m[2]); field != "" {
+				conflicts[manager] = append(conflicts[manager], field)
+			}
+			continue
+		}
+
+		if m := conflictFieldPattern.FindStringSubmatch(line); m != nil && manager != "" {
+			conflicts[manager] = append(conflicts[manager], m[1])
+			continue
+		}
+
+		manager = ""
+	}
+
+	return conflicts
+}
+
+// conflictArgs returns the args for a server-side dry run apply of the same
+// objects, with the same flags, as the apply that failed.
+func conflictArgs(vargs GKE, paths []string) []string {
+	vargs.ServerSide = true
+	args := append([]string{"apply", "--dry-run=server"}, applyFlags(vargs)...)
+	if vargs.ManifestDir != "" {
+		args = append(args, "--recursive")
+	}
+	return append(args, "--filename", strings.Join(paths, ","))
+}
+
+// reportConflicts runs a server-side dry run apply of the manifest files and
+// prints the conflicting field managers and fields.
+func reportConflicts(runner *Environ, vargs GKE, paths []string) error {
+	runner.Println("Checking field ownership conflicts with a server-side dry run")
+
+	output := &bytes.Buffer{}
+	err := runner.WithOutput(io.MultiWriter(runner.stdout, output), io.MultiWriter(runner.stderr, output)).Run(vargs.KubectlCmd, kubectlArgs(vargs, conflictArgs(vargs, paths)...)...)
+	if _, ok := exitStatus(err); err != nil && !ok {
+		return err
+	}
+
+	conflicts := parseConflicts(output.String())
+	if len(conflicts) == 0 {
+		runner.Println("No field ownership conflicts found")
+		return nil
+	}
+
+	managers := make([]string, 0, len(conflicts))
+	for m := range conflicts {
+		managers = append(managers, m)
+	}
+	sort.Strings(managers)
+
+	runner.Println("Field ownership conflicts:")
+	for _, m := range managers {
+		runner.Printf("  %s owns %s\n", m, strings.Join(conflicts[m], ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConflicts(t *testing.T) {
+	output := `error: Apply failed with 1 conflict: conflict with "kubectl-client-side-apply" using apps/v1: .spec.replicas
+Please review the fields above--they currently have other managers.
+error: Apply failed with 3 conflicts: conflicts with "hpa-controller" using autoscaling/v2:
+- .spec.replicas
+- .spec.template.spec.containers[name="app"].resources
+conflicts with "helm":
+- .metadata.labels.chart
+Please review the fields above--they currently have other managers.
+`
+
+	assert.True(t, isConflict(output))
+	assert.False(t, isConflict(`Error from server (NotFound): namespaces "app" not found`))
+
+	assert.Equal(t, map[string][]string{
+		"kubectl-client-side-apply": {".spec.replicas"},
+		"hpa-controller":            {".spec.replicas", `.spec.template.spec.containers[name="app"].resources`},
+		"helm":                      {".metadata.labels.chart"},
+	}, parseConflicts(output))
+}
+
+func TestConflictArgs(t *testing.T) {
+	assert.Equal(t, []string{"apply", "--dry-run=server", "--server-side", "--filename", "a.yml,b.yml"},
+		conflictArgs(GKE{}, []string{"a.yml", "b.yml"}))
+
+	overwrite := false
+	assert.Equal(t, []string{"apply", "--dry-run=server", "--server-side", "--overwrite=false", "--recursive", "--filename", "/tmp/manifests"},
+		conflictArgs(GKE{ServerSide: true, Overwrite: &overwrite, ManifestDir: "/tmp/manifests"}, []string{"/tmp/manifests"}))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// deployedImageArgs returns the kubectl arguments to get the images of the
+// Deployment's containers, or of the named container.
+func deployedImageArgs(deployment, container string) []string {
+	path := "{.spec.template.spec.containers[*].image}"
+	if container != "" {
+		path = fmt.Sprintf(`{.spec.template.spec.containers[?(@.name=="%s")].image}`, container)
+	}
+
+	args := []string{"get", "deployment"}
+	if parts := strings.SplitN(deployment, "/", 2); len(parts) == 2 {
+		args = append(args, parts[1], "--namespace", parts[0])
+	} else {
+		args = append(args, deployment)
+	}
+	return append(args, "--output", "jsonpath="+path)
+}
+
+// verifyDeployedImage checks that the Deployment's container uses the
+// expected image, as applied (after any mutating webhooks). Without a
+// container name, the Deployment must have a single container.
+func verifyDeployedImage(runner *Environ, vargs GKE) error {
+	out := &bytes.Buffer{}
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, deployedImageArgs(vargs.VerifyDeployment, vargs.VerifyContainer)...)...)
+	if err != nil {
+		return err
+	}
+
+	// There's no output when the command is only printed.
+	if runner.printOnly {
+		return nil
+	}
+
+	images := strings.Fields(out.String())
+	switch {
+	case len(images) == 0 && vargs.VerifyContainer != "":
+		return fmt.Errorf("deployment %s has no container %s", vargs.VerifyDeployment, vargs.VerifyContainer)
+	case len(images) != 1:
+		return fmt.Errorf("deployment %s has %d containers, set verify_container to choose one", vargs.VerifyDeployment, len(images))
+	case images[0] != vargs.VerifyDeployedImage:
+		return fmt.Errorf("deployment %s uses image %s, expected %s", vargs.VerifyDeployment, images[0], vargs.VerifyDeployedImage)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployedImageArgs(t *testing.T) {
+	assert.Equal(t, []string{"get", "deployment", "web", "--output", "jsonpath={.spec.template.spec.containers[*].image}"},
+		deployedImageArgs("web", ""))
+	assert.Equal(t, []string{"get", "deployment", "web", "--namespace", "prod", "--output", `jsonpath={.spec.template.spec.containers[?(@.name=="app")].image}`},
+		deployedImageArgs("prod/web", "app"))
+}
+
+func TestVerifyDeployedImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deployedimage")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// The Deployment has an app container and a proxy sidecar, unless only app is asked for.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+case "$*" in
+*app*) printf 'gcr.io/p/app:v2' ;;
+*) printf 'gcr.io/p/app:v2 gcr.io/p/proxy:1' ;;
+esac
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(&bytes.Buffer{})
+	vargs := GKE{KubectlCmd: script, VerifyDeployment: "web", VerifyContainer: "app", VerifyDeployedImage: "gcr.io/p/app:v2"}
+
+	assert.NoError(t, verifyDeployedImage(runner, vargs))
+
+	vargs.VerifyDeployedImage = "gcr.io/p/app:v3"
+	assert.EqualError(t, verifyDeployedImage(runner, vargs), "deployment web uses image gcr.io/p/app:v2, expected gcr.io/p/app:v3")
+
+	vargs.VerifyContainer = ""
+	assert.EqualError(t, verifyDeployedImage(runner, vargs), "deployment web has 2 containers, set verify_container to choose one")
+}
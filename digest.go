@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// digestRegexp matches an image digest, like `sha256:<hex>`.
+var digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-f0-9]{32,}$`)
+
+// readImageDigest reads an image digest from a file written by an image
+// build, which may also have the image's name, like `gcr.io/p/app@sha256:...`.
+func readImageDigest(path string) (string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	digest := strings.TrimSpace(string(blob))
+	if i := strings.LastIndex(digest, "@"); i >= 0 {
+		digest = digest[i+1:]
+	}
+
+	if !digestRegexp.MatchString(digest) {
+		return "", fmt.Errorf("%s doesn't contain an image digest, like sha256:<hex>", path)
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadImageDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	sum := "sha256:" + strings.Repeat("ab", 32)
+	for _, content := range []string{sum, sum + "\n", "gcr.io/p/app@" + sum + "\n"} {
+		path := filepath.Join(dir, "digest")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+		digest, err := readImageDigest(path)
+		assert.NoError(t, err)
+		assert.Equal(t, sum, digest)
+	}
+
+	for _, content := range []string{"", "latest", "gcr.io/p/app:v1", "sha256:xyz"} {
+		path := filepath.Join(dir, "digest")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+		_, err := readImageDigest(path)
+		assert.Error(t, err, content)
+	}
+
+	_, err = readImageDigest(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
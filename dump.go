@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 )
 
+// dumpData writes data as indented JSON. Map keys are sorted, so dumps of
+// the same data are identical, and can be diffed between builds.
 func dumpData(w io.Writer, caption string, data interface{}) {
 	fmt.Fprintf(w, "---START %s---\n", caption)
 	defer fmt.Fprintf(w, "---END %s---\n", caption)
@@ -33,3 +35,10 @@ func dumpFile(w io.Writer, caption, path string) {
 
 	fmt.Fprintln(w, string(data))
 }
+
+func dumpText(w io.Writer, caption, text string) {
+	fmt.Fprintf(w, "---START %s---\n", caption)
+	defer fmt.Fprintf(w, "---END %s---\n", caption)
+
+	fmt.Fprint(w, text)
+}
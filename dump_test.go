@@ -1,8 +1,37 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestDumpData(t *testing.T) {
+	data := map[string]interface{}{
+		"zone":    "us-east1-b",
+		"COMMIT":  "abc",
+		"cluster": "prod",
+		"vars":    map[string]interface{}{"replicas": 3, "image": "app"},
+	}
+
+	for i := 0; i < 10; i++ {
+		b := &bytes.Buffer{}
+		dumpData(b, "DATA", data)
+
+		assert.Equal(t, `---START DATA---
+{
+	"COMMIT": "abc",
+	"cluster": "prod",
+	"vars": {
+		"image": "app",
+		"replicas": 3
+	},
+	"zone": "us-east1-b"
+}
+---END DATA---
+`, b.String())
+	}
 }
 
 func TestDumpFile(t *testing.T) {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redactedVargs are the vargs whose values are never printed.
+var redactedVargs = map[string]bool{
+	"token":          true,
+	"cluster_token":  true,
+	"secrets":        true,
+	"secrets_base64": true,
+}
+
+// vargsSources returns where each of the vargs set in raw or the config file
+// (relative to dir) came from.
+func vargsSources(raw json.RawMessage, dir, config string) (map[string]string, error) {
+	sources := map[string]string{}
+
+	if config != "" {
+		blob, err := ioutil.ReadFile(filepath.Join(dir, config))
+		if err != nil {
+			return nil, err
+		}
+
+		var m map[string]interface{}
+		if err := yaml.Unmarshal(blob, &m); err != nil {
+			return nil, err
+		}
+		for k := range m {
+			sources[k] = "config"
+		}
+	}
+
+	if len(raw) > 0 {
+		var m map[string]interface{}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, err
+		}
+		for k := range m {
+			sources[k] = "vargs"
+		}
+	}
+
+	return sources, nil
+}
+
+// vargsMap returns the vargs as a map of their JSON keys to values.
+func vargsMap(vargs GKE) (map[string]interface{}, error) {
+	blob, err := json.Marshal(vargs)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(blob, &m)
+	return m, err
+}
+
+// changedVargs returns the JSON keys of the vargs that differ between a and b.
+func changedVargs(a, b GKE) ([]string, error) {
+	am, err := vargsMap(a)
+	if err != nil {
+		return nil, err
+	}
+
+	bm, err := vargsMap(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for k, v := range bm {
+		if !reflect.DeepEqual(am[k], v) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// effectiveConfig formats each of the resolved vargs with its source, or
+// "default" for those set by the plugin, redacting the tokens and secrets.
+func effectiveConfig(vargs GKE, sources map[string]string) (string, error) {
+	m, err := vargsMap(vargs)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := &bytes.Buffer{}
+	for _, k := range keys {
+		v := m[k]
+		if redactedVargs[k] && v != nil && v != "" {
+			v = redactValue(v)
+		}
+
+		blob, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		source, ok := sources[k]
+		if !ok {
+			source = "default"
+		}
+
+		fmt.Fprintf(b, "%s: %s (%s)\n", k, blob, source)
+	}
+
+	return b.String(), nil
+}
+
+// redactValue replaces a string, or the values of a map, with a placeholder.
+func redactValue(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "[redacted]"
+	}
+
+	redacted := make(map[string]interface{}, len(m))
+	for k := range m {
+		redacted[k] = "[redacted]"
+	}
+	return redacted
+}
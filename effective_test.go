@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVargsSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "effective")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "deploy.yml"), []byte("zone: us-east1-b\ncluster: base\n"), 0644))
+
+	sources, err := vargsSources(json.RawMessage(`{"config": "deploy.yml", "cluster": "prod"}`), dir, "deploy.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"config": "vargs", "cluster": "vargs", "zone": "config"}, sources)
+
+	_, err = vargsSources(json.RawMessage(`{}`), dir, "missing.yml")
+	assert.Error(t, err)
+}
+
+func TestChangedVargs(t *testing.T) {
+	changed, err := changedVargs(GKE{Project: "p"}, GKE{Project: "p", Cluster: "c", Vars: map[string]interface{}{"a": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cluster", "vars"}, changed)
+}
+
+func TestEffectiveConfigClusterToken(t *testing.T) {
+	text, err := effectiveConfig(GKE{SkipAuth: true, ClusterToken: "cluster-secret"}, map[string]string{"cluster_token": "vargs"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NotContains(t, text, "cluster-secret")
+	assert.Contains(t, text, "cluster_token: \"[redacted]\" (vargs)\n")
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	text, err := effectiveConfig(GKE{
+		Token:     "{\"private_key\": \"secret\"}",
+		Secrets:   map[string]string{"api_key": "secret"},
+		Cluster:   "prod",
+		Namespace: "web",
+	}, map[string]string{"token": "vargs", "secrets": "vargs", "cluster": "vargs", "namespace": "target_file"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NotContains(t, text, "secret\"")
+	assert.Contains(t, text, "token: \"[redacted]\" (vargs)\n")
+	assert.Contains(t, text, "secrets: {\"api_key\":\"[redacted]\"} (vargs)\n")
+	assert.Contains(t, text, "secrets_base64: null (default)\n")
+	assert.Contains(t, text, "cluster: \"prod\" (vargs)\n")
+	assert.Contains(t, text, "namespace: \"web\" (target_file)\n")
+	assert.Contains(t, text, "kubectl_cmd: \"\" (default)\n")
+	assert.True(t, strings.HasPrefix(text, "allow_secret_override: false (default)\n"), text)
+}
@@ -0,0 +1,22 @@
+package main
+
+// warningEventsArgs returns the kubectl arguments to list the namespace's
+// warning events, most recent last.
+func warningEventsArgs(vargs GKE) []string {
+	args := []string{"get", "events", "--field-selector", "type=Warning", "--sort-by", ".lastTimestamp"}
+	if vargs.Namespace != "" {
+		args = append(args, "--namespace", vargs.Namespace)
+	}
+	return args
+}
+
+// printWarningEvents prints the namespace's warning events, e.g. pods failing
+// to pull their image, warning if they can't be listed.
+func printWarningEvents(runner *Environ, vargs GKE) {
+	runner.Println("Warning events in the namespace:")
+
+	err := runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, warningEventsArgs(vargs)...)...)
+	if err != nil {
+		runner.Printf("Warning: error listing events: %s\n", err)
+	}
+}
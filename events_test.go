@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarningEventsArgs(t *testing.T) {
+	assert.Equal(t, []string{"get", "events", "--field-selector", "type=Warning", "--sort-by", ".lastTimestamp"}, warningEventsArgs(GKE{}))
+	assert.Equal(t, []string{"get", "events", "--field-selector", "type=Warning", "--sort-by", ".lastTimestamp", "--namespace", "web"}, warningEventsArgs(GKE{Namespace: "web"}))
+}
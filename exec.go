@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 )
 
 type Environ struct {
@@ -12,6 +14,16 @@ type Environ struct {
 	env    []string
 	stdout io.Writer
 	stderr io.Writer
+
+	// printOnly prints the commands without executing them.
+	printOnly bool
+
+	// noColor strips ANSI escape sequences from the output.
+	noColor bool
+
+	// log receives the commands as they're run and other progress messages,
+	// defaulting to os.Stdout.
+	log io.Writer
 }
 
 func NewEnviron(dir string, env []string, stdout, stderr io.Writer) *Environ {
@@ -23,6 +35,47 @@ func NewEnviron(dir string, env []string, stdout, stderr io.Writer) *Environ {
 	}
 }
 
+// WithOutput returns a copy of the Environ that writes to the given stdout and stderr.
+func (e *Environ) WithOutput(stdout, stderr io.Writer) *Environ {
+	c := *e
+	c.stdout = stdout
+	c.stderr = stderr
+	return &c
+}
+
+// WithEnv returns a copy of the Environ with the given environment variables
+// (KEY=value) added.
+func (e *Environ) WithEnv(env ...string) *Environ {
+	c := *e
+	c.env = append(append([]string{}, e.env...), env...)
+	return &c
+}
+
+// WithLog returns a copy of the Environ that writes progress messages to log.
+func (e *Environ) WithLog(log io.Writer) *Environ {
+	c := *e
+	c.log = log
+	return &c
+}
+
+// logOutput returns the writer for progress messages.
+func (e *Environ) logOutput() io.Writer {
+	if e.log == nil {
+		return os.Stdout
+	}
+	return e.log
+}
+
+// Printf writes a progress message.
+func (e *Environ) Printf(format string, a ...interface{}) {
+	fmt.Fprintf(e.logOutput(), format, a...)
+}
+
+// Println writes a progress message, followed by a newline.
+func (e *Environ) Println(a ...interface{}) {
+	fmt.Fprintln(e.logOutput(), a...)
+}
+
 // Run executes the given program.
 func (e *Environ) Run(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
@@ -30,11 +83,33 @@ func (e *Environ) Run(name string, arg ...string) error {
 	cmd.Env = e.env
 	cmd.Stdout = e.stdout
 	cmd.Stderr = e.stderr
+	if e.noColor {
+		cmd.Stdout = ansiStripper{e.stdout}
+		cmd.Stderr = ansiStripper{e.stderr}
+	}
+
+	e.Println()
+	e.Println("$", strings.Join(cmd.Args, " "))
 
-	// TODO: Extract this
-	fmt.Println()
-	fmt.Println("$", strings.Join(cmd.Args, " "))
-	//--
+	if e.printOnly {
+		return nil
+	}
 
 	return cmd.Run()
 }
+
+// exitStatus returns the exit status of the program that produced err, if it
+// ran to completion.
+func exitStatus(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, false
+	}
+
+	return status.ExitStatus(), true
+}
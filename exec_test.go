@@ -24,3 +24,49 @@ func TestEnvironRun(t *testing.T) {
 		assert.Equal(t, "", stderr.String())
 	}
 }
+
+func TestEnvironWithOutput(t *testing.T) {
+	e := NewEnviron("/tmp", []string{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	stdout := &bytes.Buffer{}
+	err := e.WithOutput(stdout, &bytes.Buffer{}).Run("/bin/echo", "captured")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "captured\n", stdout.String())
+		assert.Equal(t, "", e.stdout.(*bytes.Buffer).String())
+	}
+}
+
+func TestEnvironWithEnv(t *testing.T) {
+	e := NewEnviron("/tmp", []string{"A=1"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	stdout := &bytes.Buffer{}
+	err := e.WithEnv("B=2").WithOutput(stdout, &bytes.Buffer{}).Run("/bin/sh", "-c", "echo $A $B")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1 2\n", stdout.String())
+		assert.Equal(t, []string{"A=1"}, e.env)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	e := NewEnviron("/tmp", []string{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	err := e.Run("/bin/sh", "-c", "exit 1")
+	status, ok := exitStatus(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, status)
+
+	_, ok = exitStatus(e.Run("/does/not/exist"))
+	assert.False(t, ok)
+}
+
+func TestEnvironRunPrintOnly(t *testing.T) {
+	stdout := &bytes.Buffer{}
+
+	e := NewEnviron("/tmp", []string{}, stdout, &bytes.Buffer{})
+	e.printOnly = true
+
+	err := e.Run("/bin/sh", "-c", "echo executed; exit 1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", stdout.String())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+)
+
+// fanoutNamespaces returns the namespaces in the comma-separated list, with
+// the namespace prefix and suffix.
+func fanoutNamespaces(list, prefix, suffix string) ([]string, error) {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, ns := range splitList(list) {
+		if ns == "" {
+			return nil, fmt.Errorf("Error: fanout_namespaces %q contains an empty name\n", list)
+		}
+
+		ns, err := transformNamespace(ns, prefix, suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[ns] {
+			return nil, fmt.Errorf("Error: fanout_namespaces contains %s more than once\n", ns)
+		}
+		seen[ns] = true
+
+		namespaces = append(namespaces, ns)
+	}
+
+	return namespaces, nil
+}
+
+// deployFanout deploys to a cluster. With fanout_render, the whole deploy,
+// rendering included, is repeated for each fanout namespace in turn, with the
+// templates rendered with that namespace. Otherwise deployCluster renders the
+// templates once, and applies them to each fanout namespace.
+func deployFanout(vargs GKE, runner *Environ, p params) error {
+	if len(p.fanoutNamespaces) == 0 || !vargs.FanoutRender {
+		return deployCluster(vargs, runner, p)
+	}
+
+	for i, ns := range p.fanoutNamespaces {
+		runner.Printf("\nDeploying to namespace %s (%d of %d)\n", ns, i+1, len(p.fanoutNamespaces))
+
+		nv, np := vargs, p
+		nv.Namespace = ns
+		np.fanoutNamespaces = nil
+
+		err := deployCluster(nv, runner, np)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanoutNamespaces(t *testing.T) {
+	namespaces, err := fanoutNamespaces("team-a, team-b", "", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"team-a", "team-b"}, namespaces)
+	}
+
+	namespaces, err = fanoutNamespaces("a,b", "pr-", "-web")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"pr-a-web", "pr-b-web"}, namespaces)
+	}
+
+	namespaces, err = fanoutNamespaces("", "", "")
+	if assert.NoError(t, err) {
+		assert.Empty(t, namespaces)
+	}
+
+	_, err = fanoutNamespaces("a,,b", "", "")
+	assert.Error(t, err)
+
+	_, err = fanoutNamespaces("a,b,a", "", "")
+	assert.Error(t, err)
+
+	_, err = fanoutNamespaces("Team_A", "", "")
+	assert.Error(t, err)
+}
+
+func TestDeployFanout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fanout")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, ".kube.yml"), []byte("kind: ConfigMap\nmetadata:\n  name: app\n"), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	log := &bytes.Buffer{}
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(log)
+	runner.printOnly = true
+
+	vargs := GKE{
+		Project:            "p",
+		Zone:               "z",
+		Cluster:            "c",
+		GCloudCmd:          "gcloud",
+		KubectlCmd:         "kubectl",
+		Template:           ".kube.yml",
+		SecretTemplate:     ".kube.sec.yml",
+		OutputDir:          filepath.Join(dir, "out"),
+		OutputNameTemplate: defaultOutputNameTemplate,
+		MissingKey:         "error",
+		KeepRendered:       true,
+	}
+	p := params{
+		workspace:        plugin.Workspace{Path: dir},
+		fanoutNamespaces: []string{"team-a", "team-b"},
+		result:           &result{},
+	}
+
+	// The templates are rendered once, and applied to each namespace.
+	assert.NoError(t, deployFanout(vargs, runner, p))
+	assert.Equal(t, 1, strings.Count(log.String(), "get-credentials"))
+	assert.Equal(t, 2, strings.Count(log.String(), "out/.kube.yml"))
+	assert.Contains(t, log.String(), "config set-context gke_p_z_c --namespace team-a")
+	assert.Contains(t, log.String(), "config set-context gke_p_z_c --namespace team-b")
+
+	// With fanout_render, the whole deploy is repeated for each namespace.
+	log.Reset()
+	vargs.FanoutRender = true
+	assert.NoError(t, deployFanout(vargs, runner, p))
+	assert.Equal(t, 2, strings.Count(log.String(), "get-credentials"))
+	assert.Equal(t, 2, strings.Count(log.String(), "out/.kube.yml"))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frontMatterPrefix starts the front-matter comment of a template, e.g.
+// `# drone-gke: secrets=true`.
+const frontMatterPrefix = "drone-gke:"
+
+// templateOptions are the options a template can set in its front-matter.
+type templateOptions struct {
+	// Secrets renders the template with the secrets, as well as the vars.
+	Secrets bool
+}
+
+// parseFrontMatter reads the template's options from a front-matter comment
+// among the comments at its top, before any other line.
+func parseFrontMatter(blob []byte) (templateOptions, error) {
+	opts := templateOptions{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "---" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		if !strings.HasPrefix(comment, frontMatterPrefix) {
+			continue
+		}
+
+		m, err := parseKeyValues(strings.TrimPrefix(comment, frontMatterPrefix))
+		if err != nil {
+			return opts, err
+		}
+
+		for k, v := range m {
+			switch k {
+			case "secrets":
+				opts.Secrets, err = strconv.ParseBool(v)
+				if err != nil {
+					return opts, fmt.Errorf("secrets must be true or false, not %q", v)
+				}
+			default:
+				return opts, fmt.Errorf("unknown option %q", k)
+			}
+		}
+	}
+
+	return opts, scanner.Err()
+}
+
+// secretsAndData returns the data with the secrets added, for a template
+// with secrets. Secrets can't shadow the data.
+func secretsAndData(data, secrets map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(data)+len(secrets))
+	for k, v := range data {
+		merged[k] = v
+	}
+
+	for k, v := range secrets {
+		if _, ok := merged[k]; ok {
+			return nil, fmt.Errorf("secret var %q shadows existing var", k)
+		}
+		merged[k] = v
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	opts, err := parseFrontMatter([]byte("# Web deployment\n#   drone-gke: secrets=true\n---\nkind: Secret\n"))
+	if assert.NoError(t, err) {
+		assert.True(t, opts.Secrets)
+	}
+
+	opts, err = parseFrontMatter([]byte("#drone-gke: secrets=false\nkind: Deployment\n"))
+	if assert.NoError(t, err) {
+		assert.False(t, opts.Secrets)
+	}
+
+	// Only comments at the top count.
+	opts, err = parseFrontMatter([]byte("kind: Deployment\n# drone-gke: secrets=true\n"))
+	if assert.NoError(t, err) {
+		assert.False(t, opts.Secrets)
+	}
+
+	_, err = parseFrontMatter([]byte("# drone-gke: secrets=yes please\n"))
+	assert.Error(t, err)
+
+	_, err = parseFrontMatter([]byte("# drone-gke: secret=true\n"))
+	assert.Error(t, err)
+}
+
+func TestSecretsAndData(t *testing.T) {
+	merged, err := secretsAndData(map[string]interface{}{"app": "web"}, map[string]interface{}{"DB_PASSWORD": "cGFzcw=="})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"app": "web", "DB_PASSWORD": "cGFzcw=="}, merged)
+	}
+
+	_, err = secretsAndData(map[string]interface{}{"app": "web"}, map[string]interface{}{"app": "d2Vi"})
+	assert.Error(t, err)
+}
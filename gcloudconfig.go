@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// gcloudConfig holds the properties of the active gcloud configuration that we use.
+type gcloudConfig struct {
+	Compute struct {
+		Zone   string `json:"zone"`
+		Region string `json:"region"`
+	} `json:"compute"`
+	Core struct {
+		Project string `json:"project"`
+	} `json:"core"`
+}
+
+// readGCloudConfig reads the active gcloud configuration.
+func readGCloudConfig(runner *Environ, vargs GKE) (gcloudConfig, error) {
+	config := gcloudConfig{}
+
+	out := &bytes.Buffer{}
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.GCloudCmd, "config", "list", "--format", "json")
+	if err != nil {
+		return config, err
+	}
+
+	// There's no output when the command is only printed.
+	if runner.printOnly {
+		return config, nil
+	}
+
+	err = json.Unmarshal(out.Bytes(), &config)
+	if err != nil {
+		return config, fmt.Errorf("error parsing gcloud configuration: %s", err)
+	}
+
+	return config, nil
+}
+
+// applyGCloudConfig fills the project and location that weren't explicitly set in vargs from config.
+func applyGCloudConfig(vargs *GKE, config gcloudConfig) {
+	if vargs.Project == "" {
+		vargs.Project = config.Core.Project
+	}
+
+	// Prefer the zone, as when both are configured it's usually the more specific default.
+	if vargs.Zone == "" && vargs.Region == "" {
+		if config.Compute.Zone != "" {
+			vargs.Zone = config.Compute.Zone
+		} else {
+			vargs.Region = config.Compute.Region
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyGCloudConfig(t *testing.T) {
+	config := gcloudConfig{}
+	err := json.Unmarshal([]byte(`{
+		"compute": {"region": "us-east1", "zone": "us-east1-b"},
+		"core": {"account": "deployer@my-project.iam.gserviceaccount.com", "project": "my-project"}
+	}`), &config)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vargs := GKE{}
+	applyGCloudConfig(&vargs, config)
+	assert.Equal(t, GKE{Project: "my-project", Zone: "us-east1-b"}, vargs)
+
+	vargs = GKE{Project: "explicit", Region: "europe-west1"}
+	applyGCloudConfig(&vargs, config)
+	assert.Equal(t, GKE{Project: "explicit", Region: "europe-west1"}, vargs)
+
+	config.Compute.Zone = ""
+	vargs = GKE{}
+	applyGCloudConfig(&vargs, config)
+	assert.Equal(t, GKE{Project: "my-project", Region: "us-east1"}, vargs)
+}
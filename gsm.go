@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// accessGSMSecret fetches a secret version's payload from Google Secret
+// Manager, by its resource name (projects/p/secrets/s/versions/v).
+func accessGSMSecret(runner *Environ, vargs GKE, name string) (string, error) {
+	out := &bytes.Buffer{}
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.GCloudCmd, "secrets", "versions", "access", name)
+	if err != nil {
+		return "", err
+	}
+
+	// There's no payload when the command is only printed.
+	if runner.printOnly {
+		return fmt.Sprintf("[%s]", name), nil
+	}
+
+	return out.String(), nil
+}
+
+// fetchGSMSecrets fetches each of the Secret Manager secrets.
+func fetchGSMSecrets(runner *Environ, vargs GKE) (map[string]string, error) {
+	secrets := make(map[string]string, len(vargs.GSMSecrets))
+
+	for k, name := range vargs.GSMSecrets {
+		v, err := accessGSMSecret(runner, vargs, name)
+		if err != nil {
+			return nil, fmt.Errorf("Error accessing secret %s: %s\n", name, err)
+		}
+
+		secrets[k] = v
+	}
+
+	return secrets, nil
+}
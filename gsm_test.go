@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchGSMSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsm")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Print the payload of each secret, named after it, unless it's missing.
+	script := filepath.Join(dir, "gcloud")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+[ "$*" = "secrets versions access $4" ] || exit 2
+case "$4" in
+*/missing/*) echo "NOT_FOUND: Secret not found" >&2; exit 1 ;;
+*) printf 'payload of %s' "$(echo "$4" | cut -d/ -f4)" ;;
+esac
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	log := &bytes.Buffer{}
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(log)
+	vargs := GKE{GCloudCmd: script, GSMSecrets: map[string]string{
+		"db_password": "projects/p/secrets/db-password/versions/latest",
+		"api_key":     "projects/p/secrets/api-key/versions/3",
+	}}
+
+	secrets, err := fetchGSMSecrets(runner, vargs)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{
+			"db_password": "payload of db-password",
+			"api_key":     "payload of api-key",
+		}, secrets)
+	}
+
+	// The payloads are never logged, only the commands.
+	assert.Contains(t, log.String(), script+" secrets versions access projects/p/secrets/api-key/versions/3")
+	assert.NotContains(t, log.String(), "payload of")
+
+	vargs.GSMSecrets = map[string]string{"token": "projects/p/secrets/missing/versions/1"}
+	_, err = fetchGSMSecrets(runner, vargs)
+	assert.EqualError(t, err, "Error accessing secret projects/p/secrets/missing/versions/1: exit status 1\n")
+
+	secrets, err = fetchGSMSecrets(runner, GKE{GCloudCmd: script})
+	if assert.NoError(t, err) {
+		assert.Empty(t, secrets)
+	}
+}
+
+func TestAccessGSMSecretPrintOnly(t *testing.T) {
+	runner := NewEnviron("/tmp", []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(&bytes.Buffer{})
+	runner.printOnly = true
+
+	v, err := accessGSMSecret(runner, GKE{GCloudCmd: "/does/not/exist"}, "projects/p/secrets/s/versions/1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[projects/p/secrets/s/versions/1]", v)
+	}
+}
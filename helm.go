@@ -0,0 +1,13 @@
+package main
+
+// helmTemplateArgs returns the `helm template` arguments to render the chart.
+func helmTemplateArgs(vargs GKE) []string {
+	args := []string{"template", vargs.HelmRelease, vargs.HelmChart}
+	if vargs.Namespace != "" {
+		args = append(args, "--namespace", vargs.Namespace)
+	}
+	for _, f := range vargs.HelmValues {
+		args = append(args, "--values", f)
+	}
+	return args
+}
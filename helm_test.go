@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHelmTemplateArgs(t *testing.T) {
+	assert.Equal(t, []string{"template", "web", "charts/web"}, helmTemplateArgs(GKE{HelmChart: "charts/web", HelmRelease: "web"}))
+
+	assert.Equal(t, []string{
+		"template", "api", "charts/web",
+		"--namespace", "prod",
+		"--values", "charts/web/values-prod.yaml",
+		"--values", "overrides.yaml",
+	}, helmTemplateArgs(GKE{
+		HelmChart:   "charts/web",
+		HelmRelease: "api",
+		Namespace:   "prod",
+		HelmValues:  []string{"charts/web/values-prod.yaml", "overrides.yaml"},
+	}))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// documentImages returns the images of the containers in the documents,
+// sorted and without duplicates.
+func documentImages(docs []document) []string {
+	seen := map[string]bool{}
+	images := []string{}
+	for _, d := range docs {
+		spec, ok := podSpec(d)
+		if !ok {
+			continue
+		}
+
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _ := spec[field].([]interface{})
+			for _, c := range containers {
+				container, _ := c.(map[string]interface{})
+				image, _ := container["image"].(string)
+				if image != "" && !seen[image] {
+					seen[image] = true
+					images = append(images, image)
+				}
+			}
+		}
+	}
+
+	sort.Strings(images)
+	return images
+}
+
+// imageRegistry returns the registry gcloud can describe an image in: "gcr"
+// for Container Registry, "ar" for Artifact Registry, or "" for others.
+func imageRegistry(image string) string {
+	host := image[:strings.Index(image+"/", "/")]
+
+	switch {
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io"):
+		return "gcr"
+	case strings.HasSuffix(host, "-docker.pkg.dev"):
+		return "ar"
+	}
+	return ""
+}
+
+// describeImageArgs returns the gcloud arguments to describe an image in the
+// registry.
+func describeImageArgs(registry, image string) []string {
+	if registry == "ar" {
+		return []string{"artifacts", "docker", "images", "describe", image}
+	}
+	return []string{"container", "images", "describe", image}
+}
+
+// verifyImages describes each of the images in GCR or Artifact Registry, and
+// returns the ones that don't exist (or that the service account can't see).
+// Images in other registries are skipped.
+func verifyImages(runner *Environ, vargs GKE, images []string) []string {
+	missing := []string{}
+	for _, image := range images {
+		registry := imageRegistry(image)
+		if registry == "" {
+			runner.Printf("Skipping verification of %s, because it's not in Container Registry or Artifact Registry\n", image)
+			continue
+		}
+
+		// Only the failure is of interest, not the description.
+		out := &bytes.Buffer{}
+		err := runner.WithOutput(out, out).Run(vargs.GCloudCmd, describeImageArgs(registry, image)...)
+		if err != nil {
+			runner.stderr.Write(out.Bytes())
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentImages(t *testing.T) {
+	docs, err := parseDocuments([]byte(`
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: gcr.io/p/migrate:1
+      containers:
+      - name: app
+        image: gcr.io/p/app:2
+---
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: report
+            image: gcr.io/p/app:2
+---
+kind: Service
+metadata:
+  name: web
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"gcr.io/p/app:2", "gcr.io/p/migrate:1"}, documentImages(docs))
+}
+
+func TestImageRegistry(t *testing.T) {
+	assert.Equal(t, "gcr", imageRegistry("gcr.io/p/app:1"))
+	assert.Equal(t, "gcr", imageRegistry("eu.gcr.io/p/app@sha256:abc"))
+	assert.Equal(t, "ar", imageRegistry("us-east1-docker.pkg.dev/p/repo/app:1"))
+	assert.Equal(t, "", imageRegistry("nginx:1.19"))
+	assert.Equal(t, "", imageRegistry("quay.io/gcr.io/app"))
+}
+
+func TestVerifyImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Only app:1 exists.
+	script := filepath.Join(dir, "gcloud")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+for a; do last=$a; done
+case $last in
+*/app:1) echo "image_summary:" ;;
+*) echo "ERROR: (gcloud.container.images.describe) manifest unknown" >&2; exit 1 ;;
+esac
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out := &bytes.Buffer{}
+	runner := NewEnviron(dir, []string{}, out, out).WithLog(out)
+
+	missing := verifyImages(runner, GKE{GCloudCmd: script}, []string{
+		"gcr.io/p/app:1",
+		"gcr.io/p/app:typo",
+		"us-east1-docker.pkg.dev/p/repo/app:1",
+		"nginx:1.19",
+	})
+	assert.Equal(t, []string{"gcr.io/p/app:typo"}, missing)
+	assert.Contains(t, out.String(), "manifest unknown")
+	assert.Contains(t, out.String(), "Skipping verification of nginx:1.19")
+	assert.NotContains(t, out.String(), "image_summary")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// indexEntry records a manifest applied to a cluster.
+type indexEntry struct {
+	File      string `json:"file"`
+	Template  string `json:"template,omitempty"`
+	SHA256    string `json:"sha256"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// manifestIndex lists the manifests applied to each cluster.
+type manifestIndex struct {
+	Manifests []indexEntry `json:"manifests"`
+
+	// mu guards Manifests, which clusters deployed in parallel add to.
+	mu sync.Mutex
+}
+
+// add records the manifest files applied to the cluster. templates maps
+// rendered files to the templates they were rendered from.
+func (x *manifestIndex) add(vargs GKE, dir string, files []string, templates map[string]string) error {
+	entries := make([]indexEntry, 0, len(files))
+	for _, f := range files {
+		blob, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(blob)
+
+		entries = append(entries, indexEntry{
+			File:      relPath(dir, f),
+			Template:  templates[f],
+			SHA256:    hex.EncodeToString(sum[:]),
+			Cluster:   vargs.Cluster,
+			Namespace: vargs.Namespace,
+		})
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.Manifests = append(x.Manifests, entries...)
+	return nil
+}
+
+// write writes the index as JSON to path.
+func (x *manifestIndex) write(path string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.Manifests == nil {
+		x.Manifests = []indexEntry{}
+	}
+
+	blob, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
+
+// relPath returns path relative to dir if it's inside it, or its base name.
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(path)
+	}
+	return rel
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	rendered := filepath.Join(dir, "out", ".kube.yml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(rendered), 0755))
+	assert.NoError(t, ioutil.WriteFile(rendered, []byte("kind: Service\n"), 0644))
+
+	x := &manifestIndex{}
+	err = x.add(GKE{Cluster: "prod", Namespace: "web"}, dir, []string{rendered}, map[string]string{rendered: ".kube.yml"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	path := filepath.Join(dir, "index.json")
+	assert.NoError(t, x.write(path))
+
+	blob, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"manifests": [{
+		"file": "out/.kube.yml",
+		"template": ".kube.yml",
+		"sha256": "0986089a4d6c36657cb202f9580c17af4d96f818afca398410926f5b9703104d",
+		"cluster": "prod",
+		"namespace": "web"
+	}]}`, string(blob))
+
+	assert.Error(t, x.add(GKE{}, dir, []string{filepath.Join(dir, "missing.yml")}, nil))
+}
+
+func TestRelPath(t *testing.T) {
+	assert.Equal(t, "out/a.yml", relPath("/workspace", "/workspace/out/a.yml"))
+	assert.Equal(t, "a.yml", relPath("/workspace", "/tmp/a.yml"))
+}
@@ -0,0 +1,25 @@
+package main
+
+// clusterTokenPath is where the cluster token is written for kubectl, with
+// skip_auth. Like the gcloud key file, it's inside the plugin container.
+const clusterTokenPath = "/tmp/cluster-token"
+
+// kubeconfigArgs returns the kubectl config commands that create a cluster,
+// user and context, each named after the cluster, to connect to the API
+// server with skip_auth. The token is read from tokenFile, so it's never on
+// the command line.
+func kubeconfigArgs(vargs GKE, caFile, tokenFile string) [][]string {
+	name := vargs.Cluster
+
+	cluster := []string{"config", "set-cluster", name, "--server", vargs.APIServer}
+	if caFile != "" {
+		cluster = append(cluster, "--certificate-authority", caFile, "--embed-certs=true")
+	}
+
+	return [][]string{
+		cluster,
+		{"config", "set-credentials", name},
+		{"config", "set", "users." + name + ".tokenFile", tokenFile},
+		{"config", "set-context", name, "--cluster", name, "--user", name},
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubeconfigArgs(t *testing.T) {
+	vargs := GKE{Cluster: "edge", APIServer: "https://10.0.0.1", ClusterToken: "token"}
+
+	assert.Equal(t, [][]string{
+		{"config", "set-cluster", "edge", "--server", "https://10.0.0.1", "--certificate-authority", "/workspace/ca.crt", "--embed-certs=true"},
+		{"config", "set-credentials", "edge"},
+		{"config", "set", "users.edge.tokenFile", "/tmp/cluster-token"},
+		{"config", "set-context", "edge", "--cluster", "edge", "--user", "edge"},
+	}, kubeconfigArgs(vargs, "/workspace/ca.crt", "/tmp/cluster-token"))
+
+	args := kubeconfigArgs(vargs, "", "/tmp/cluster-token")
+	assert.Equal(t, []string{"config", "set-cluster", "edge", "--server", "https://10.0.0.1"}, args[0])
+
+	for _, a := range args {
+		assert.NotContains(t, a, "token")
+	}
+}
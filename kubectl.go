@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPruneWhitelist is kubectl's default set of resources to prune,
+// excluding the cluster-scoped Namespace and PersistentVolume.
+var defaultPruneWhitelist = []string{
+	"core/v1/ConfigMap",
+	"core/v1/Endpoints",
+	"core/v1/PersistentVolumeClaim",
+	"core/v1/Pod",
+	"core/v1/ReplicationController",
+	"core/v1/Secret",
+	"core/v1/Service",
+	"batch/v1/Job",
+	"batch/v1beta1/CronJob",
+	"extensions/v1beta1/Ingress",
+	"apps/v1/DaemonSet",
+	"apps/v1/Deployment",
+	"apps/v1/ReplicaSet",
+	"apps/v1/StatefulSet",
+}
+
+// clusterScopedKinds are never allowed in the prune whitelist.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"PodSecurityPolicy":              true,
+	"PriorityClass":                  true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// kubectlArgs returns the arguments for a kubectl command that contacts the
+// cluster, followed by the global flags configured in vargs.
+func kubectlArgs(vargs GKE, arg ...string) []string {
+	args := append([]string{}, arg...)
+
+	if vargs.Context != "" {
+		args = append(args, "--context", vargs.Context)
+	}
+
+	if vargs.As != "" {
+		args = append(args, "--as", vargs.As)
+	}
+	for _, g := range vargs.AsGroup {
+		args = append(args, "--as-group", g)
+	}
+
+	// Commands that target another namespace already set their own.
+	if inlineNamespace(vargs) && !hasNamespaceFlag(arg) {
+		args = append(args, "--namespace", vargs.Namespace)
+	}
+
+	if vargs.RequestTimeout != "" {
+		args = append(args, "--request-timeout", vargs.RequestTimeout)
+	}
+
+	return args
+}
+
+// namespaceModes are the ways of applying the namespace to kubectl commands:
+// by setting it on the context, inline with --namespace, or both.
+var namespaceModes = map[string]bool{"context": true, "inline": true, "both": true}
+
+// inlineNamespace reports whether kubectl commands get an inline --namespace.
+func inlineNamespace(vargs GKE) bool {
+	return vargs.Namespace != "" && (vargs.NamespaceMode == "inline" || vargs.NamespaceMode == "both")
+}
+
+// hasNamespaceFlag reports whether the kubectl arguments set the namespace.
+func hasNamespaceFlag(arg []string) bool {
+	for _, a := range arg {
+		if a == "--namespace" || a == "-n" || strings.HasPrefix(a, "--namespace=") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRequestTimeout checks that v is accepted by kubectl's --request-timeout,
+// either an integer number of seconds or a duration like 30s or 1m.
+func validateRequestTimeout(v string) error {
+	if _, err := strconv.Atoi(v); err == nil {
+		return nil
+	}
+
+	if _, err := time.ParseDuration(v); err != nil {
+		return fmt.Errorf("Error: invalid request_timeout %q: %s\n", v, err)
+	}
+
+	return nil
+}
+
+// validatePrune checks that pruning is scoped to the managed label and the
+// namespace, and that it can't touch cluster-scoped resources.
+func validatePrune(vargs GKE) error {
+	if vargs.PruneLabel == "" {
+		// kubectl would need --all, pruning everything in the namespace that isn't in the manifests.
+		return fmt.Errorf("Missing required param: prune_label (when prune is set)")
+	}
+
+	if vargs.Namespace == "" {
+		return fmt.Errorf("Missing required param: namespace (when prune is set)")
+	}
+
+	for _, r := range vargs.PruneWhitelist {
+		parts := strings.Split(r, "/")
+		if len(parts) != 3 {
+			return fmt.Errorf("Error: invalid prune_whitelist entry %q, expected group/version/kind\n", r)
+		}
+
+		if clusterScopedKinds[parts[2]] {
+			return fmt.Errorf("Error: prune_whitelist entry %q is cluster-scoped\n", r)
+		}
+	}
+
+	if vargs.PruneCascade != "" && !pruneCascades[vargs.PruneCascade] {
+		return fmt.Errorf("Error: invalid prune_cascade %q, expected background, foreground or orphan\n", vargs.PruneCascade)
+	}
+
+	return nil
+}
+
+// pruneCascades are the ways kubectl can delete the dependents of pruned objects.
+var pruneCascades = map[string]bool{"background": true, "foreground": true, "orphan": true}
+
+// pruneArgs returns the kubectl apply arguments to prune objects with the
+// managed label that are no longer in the manifests.
+func pruneArgs(vargs GKE) []string {
+	// --selector and --all are mutually exclusive, and the managed label is required,
+	// so --all is never passed.
+	args := []string{"--prune", "--selector", vargs.PruneLabel, "--namespace", vargs.Namespace}
+
+	whitelist := vargs.PruneWhitelist
+	if len(whitelist) == 0 {
+		whitelist = defaultPruneWhitelist
+	}
+	for _, r := range whitelist {
+		args = append(args, "--prune-whitelist", r)
+	}
+
+	if vargs.PruneCascade != "" {
+		args = append(args, "--cascade="+vargs.PruneCascade)
+	}
+
+	return args
+}
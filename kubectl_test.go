@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubectlArgs(t *testing.T) {
+	assert.Equal(t, []string{"apply", "--filename", "a.yml"}, kubectlArgs(GKE{}, "apply", "--filename", "a.yml"))
+
+	vargs := GKE{RequestTimeout: "30s"}
+	assert.Equal(t, []string{"apply", "--filename", "a.yml", "--request-timeout", "30s"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+
+	vargs.Context = "gke_my-project_us-east1_my-cluster"
+	assert.Equal(t, []string{"apply", "--filename", "a.yml", "--context", "gke_my-project_us-east1_my-cluster", "--request-timeout", "30s"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+}
+
+func TestKubectlArgsImpersonation(t *testing.T) {
+	vargs := GKE{As: "deployer", AsGroup: []string{"deployers", "auditors"}}
+	assert.Equal(t, []string{"apply", "--filename", "a.yml", "--as", "deployer", "--as-group", "deployers", "--as-group", "auditors"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+}
+
+func TestKubectlArgsNamespaceMode(t *testing.T) {
+	vargs := GKE{Namespace: "app", NamespaceMode: "context"}
+	assert.Equal(t, []string{"apply", "--filename", "a.yml"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+
+	for _, mode := range []string{"inline", "both"} {
+		vargs.NamespaceMode = mode
+		assert.Equal(t, []string{"apply", "--filename", "a.yml", "--namespace", "app"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+		assert.Equal(t, []string{"get", "service", "lb", "--namespace", "other"}, kubectlArgs(vargs, "get", "service", "lb", "--namespace", "other"))
+	}
+
+	vargs.Namespace = ""
+	assert.Equal(t, []string{"apply", "--filename", "a.yml"}, kubectlArgs(vargs, "apply", "--filename", "a.yml"))
+}
+
+func TestValidateRequestTimeout(t *testing.T) {
+	for _, v := range []string{"0", "30", "30s", "1m", "1h30m"} {
+		assert.NoError(t, validateRequestTimeout(v), v)
+	}
+
+	for _, v := range []string{"soon", "30x", "-"} {
+		assert.Error(t, validateRequestTimeout(v), v)
+	}
+}
+
+func TestValidatePrune(t *testing.T) {
+	assert.Error(t, validatePrune(GKE{Prune: true, Namespace: "ns"}))
+	assert.Error(t, validatePrune(GKE{Prune: true, PruneLabel: "app=a"}))
+	assert.NoError(t, validatePrune(GKE{Prune: true, PruneLabel: "app=a", Namespace: "ns"}))
+
+	vargs := GKE{Prune: true, PruneLabel: "app=a", Namespace: "ns", PruneWhitelist: []string{"apps/v1/Deployment"}}
+	assert.NoError(t, validatePrune(vargs))
+
+	vargs.PruneWhitelist = []string{"core/v1/Namespace"}
+	assert.Error(t, validatePrune(vargs))
+
+	vargs.PruneWhitelist = []string{"Deployment"}
+	assert.Error(t, validatePrune(vargs))
+
+	vargs.PruneWhitelist = nil
+	vargs.PruneCascade = "orphan"
+	assert.NoError(t, validatePrune(vargs))
+
+	vargs.PruneCascade = "true"
+	assert.Error(t, validatePrune(vargs))
+}
+
+func TestPruneArgs(t *testing.T) {
+	vargs := GKE{Prune: true, PruneLabel: "app=a", Namespace: "ns", PruneWhitelist: []string{"apps/v1/Deployment"}}
+	assert.Equal(t, []string{
+		"--prune", "--selector", "app=a", "--namespace", "ns",
+		"--prune-whitelist", "apps/v1/Deployment",
+	}, pruneArgs(vargs))
+
+	vargs.PruneWhitelist = nil
+	assert.NotContains(t, pruneArgs(vargs), "core/v1/Namespace")
+	assert.NotContains(t, pruneArgs(vargs), "--all")
+	assert.NotContains(t, pruneArgs(vargs), "--cascade=foreground")
+
+	vargs.PruneCascade = "foreground"
+	assert.Contains(t, pruneArgs(vargs), "--cascade=foreground")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// podSpec returns the pod spec of a workload object, if it has one.
+func podSpec(doc document) (map[string]interface{}, bool) {
+	spec, _ := doc.Object["spec"].(map[string]interface{})
+
+	switch doc.Kind {
+	case "Pod":
+	case "CronJob":
+		job, _ := spec["jobTemplate"].(map[string]interface{})
+		jobSpec, _ := job["spec"].(map[string]interface{})
+		tmpl, _ := jobSpec["template"].(map[string]interface{})
+		spec, _ = tmpl["spec"].(map[string]interface{})
+	default:
+		tmpl, _ := spec["template"].(map[string]interface{})
+		spec, _ = tmpl["spec"].(map[string]interface{})
+	}
+
+	return spec, spec != nil
+}
+
+// imageTag returns the tag of an image reference, or "" if it has none.
+// Images pinned by digest are reported with the tag "@digest".
+func imageTag(image string) string {
+	if strings.Contains(image, "@") {
+		return "@digest"
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// lintImages returns the containers in the documents whose image is
+// untagged or tagged latest, or that have no explicit imagePullPolicy.
+func lintImages(docs []document) []string {
+	problems := []string{}
+	for _, d := range docs {
+		spec, ok := podSpec(d)
+		if !ok {
+			continue
+		}
+
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _ := spec[field].([]interface{})
+			for _, c := range containers {
+				container, _ := c.(map[string]interface{})
+				name, _ := container["name"].(string)
+				image, _ := container["image"].(string)
+				where := fmt.Sprintf("%s/%s container %s", d.Kind, d.Name, name)
+
+				switch imageTag(image) {
+				case "":
+					problems = append(problems, fmt.Sprintf("%s has no image tag: %s", where, image))
+				case "latest":
+					problems = append(problems, fmt.Sprintf("%s uses the latest tag: %s", where, image))
+				}
+
+				if _, ok := container["imagePullPolicy"]; !ok {
+					problems = append(problems, fmt.Sprintf("%s has no imagePullPolicy", where))
+				}
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageTag(t *testing.T) {
+	assert.Equal(t, "", imageTag("nginx"))
+	assert.Equal(t, "1.19", imageTag("nginx:1.19"))
+	assert.Equal(t, "", imageTag("localhost:5000/nginx"))
+	assert.Equal(t, "v2", imageTag("localhost:5000/team/app:v2"))
+	assert.Equal(t, "@digest", imageTag("gcr.io/p/app@sha256:abc"))
+}
+
+func TestLintImages(t *testing.T) {
+	docs, err := parseDocuments([]byte(`
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: gcr.io/p/migrate
+        imagePullPolicy: Always
+      containers:
+      - name: app
+        image: gcr.io/p/app:latest
+      - name: proxy
+        image: gcr.io/p/proxy:1.2
+        imagePullPolicy: IfNotPresent
+---
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: report
+            image: gcr.io/p/report@sha256:abc
+            imagePullPolicy: IfNotPresent
+---
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+  - name: shell
+    image: busybox
+---
+kind: Service
+metadata:
+  name: web
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		"Deployment/web container migrate has no image tag: gcr.io/p/migrate",
+		"Deployment/web container app uses the latest tag: gcr.io/p/app:latest",
+		"Deployment/web container app has no imagePullPolicy",
+		"Pod/debug container shell has no image tag: busybox",
+		"Pod/debug container shell has no imagePullPolicy",
+	}, lintImages(docs))
+}
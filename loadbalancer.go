@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// lbPollInterval is how often to check for the load balancer's IP.
+var lbPollInterval = 5 * time.Second
+
+// waitLoadBalancerIP polls the Service (namespace/name or name) until its
+// load balancer has been assigned an ingress IP, and returns the IP.
+func waitLoadBalancerIP(runner *Environ, vargs GKE, service string, timeout time.Duration) (string, error) {
+	args := []string{"get", "service"}
+	if parts := strings.SplitN(service, "/", 2); len(parts) == 2 {
+		args = append(args, parts[1], "--namespace", parts[0])
+	} else {
+		args = append(args, service)
+	}
+	args = append(args, "--output", "jsonpath={.status.loadBalancer.ingress[0].ip}")
+
+	deadline := time.Now().Add(timeout)
+	for {
+		out := &bytes.Buffer{}
+		err := runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, args...)...)
+		if err != nil {
+			return "", err
+		}
+
+		if ip := strings.TrimSpace(out.String()); ip != "" || runner.printOnly {
+			return ip, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out after %s waiting for a load balancer IP for %s", timeout, service)
+		}
+
+		time.Sleep(lbPollInterval)
+	}
+}
+
+// writeEnvOutput appends key=value to the env file at path, for later pipeline steps to source.
+func writeEnvOutput(path, key, value string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "%s=%s\n", key, value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
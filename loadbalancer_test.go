@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteEnvOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".env")
+	assert.NoError(t, writeEnvOutput(path, "LB_IP", "10.0.0.1"))
+	assert.NoError(t, writeEnvOutput(path, "OTHER_IP", "10.0.0.2"))
+
+	blob, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "LB_IP=10.0.0.1\nOTHER_IP=10.0.0.2\n", string(blob))
+	}
+}
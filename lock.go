@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// lockName is the ConfigMap used as the namespace's deploy lock.
+const lockName = "drone-gke-lock"
+
+// lockObjectName returns the name of the deploy lock ConfigMap. In the system
+// namespace, it's suffixed with the namespace it locks.
+func lockObjectName(vargs GKE) string {
+	if vargs.SystemNamespace != "" && vargs.Namespace != "" {
+		return lockName + "-" + vargs.Namespace
+	}
+	return lockName
+}
+
+// lockArgs returns the arguments for a kubectl command on the deploy lock,
+// in the system namespace if it's set.
+func lockArgs(vargs GKE, arg ...string) []string {
+	if vargs.SystemNamespace != "" {
+		arg = append(arg, "--namespace", vargs.SystemNamespace)
+	}
+	return kubectlArgs(vargs, arg...)
+}
+
+const (
+	lockBuildAnnotation    = "drone-gke/build"
+	lockAcquiredAnnotation = "drone-gke/acquired"
+)
+
+// lockManifest returns the lock ConfigMap, annotated with the build that holds it.
+func lockManifest(name string, build int, acquired time.Time) string {
+	b := &bytes.Buffer{}
+
+	fmt.Fprintf(b, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n", name)
+	writeYAMLMap(b, "annotations", map[string]string{
+		lockBuildAnnotation:    strconv.Itoa(build),
+		lockAcquiredAnnotation: acquired.UTC().Format(time.RFC3339),
+	})
+
+	return b.String()
+}
+
+// lockHolder returns the build holding the lock, and when it was acquired,
+// from the lock ConfigMap's JSON. The time is zero if the lock's acquired
+// annotation is missing or invalid.
+func lockHolder(blob []byte) (string, time.Time, error) {
+	var obj struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+
+	err := json.Unmarshal(blob, &obj)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	annotations := obj.Metadata.Annotations
+	acquired, err := time.Parse(time.RFC3339, annotations[lockAcquiredAnnotation])
+	if err != nil {
+		return annotations[lockBuildAnnotation], time.Time{}, nil
+	}
+
+	return annotations[lockBuildAnnotation], acquired, nil
+}
+
+// acquireLock creates the deploy lock in the current or system namespace. It fails if
+// another build holds the lock, unless the lock is older than timeout.
+func acquireLock(runner *Environ, vargs GKE, build int, timeout time.Duration) error {
+	name := lockObjectName(vargs)
+
+	out := &bytes.Buffer{}
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, lockArgs(vargs, "get", "configmap", name, "--ignore-not-found", "--output", "json")...)
+	if err != nil {
+		return err
+	}
+
+	if existing := bytes.TrimSpace(out.Bytes()); len(existing) > 0 {
+		holder, acquired, err := lockHolder(existing)
+		if err != nil {
+			return fmt.Errorf("error reading deploy lock: %s", err)
+		}
+
+		// A lock that doesn't say when it was acquired could never expire.
+		if acquired.IsZero() {
+			runner.Printf("Warning: taking over the deploy lock from build %q, because its %s annotation is missing or invalid\n", holder, lockAcquiredAnnotation)
+		} else {
+			age := time.Now().Sub(acquired) / time.Second * time.Second
+			if age < timeout {
+				return fmt.Errorf("the namespace is locked by build %s, acquired %s ago (lock_timeout is %s)", holder, age, timeout)
+			}
+
+			runner.Printf("Warning: taking over the deploy lock from build %s, acquired %s ago\n", holder, age)
+		}
+
+		err = runner.Run(vargs.KubectlCmd, lockArgs(vargs, "delete", "configmap", name, "--ignore-not-found")...)
+		if err != nil {
+			return err
+		}
+	}
+
+	lockPath := filepath.Join(vargs.OutputDir, "deploy-lock.yml")
+	err = ioutil.WriteFile(lockPath, []byte(lockManifest(name, build, time.Now())), 0600)
+	if err != nil {
+		return fmt.Errorf("error writing deploy lock file: %s", err)
+	}
+	defer os.Remove(lockPath)
+
+	// Unlike apply, create fails if another build acquired the lock in the meantime.
+	return runner.Run(vargs.KubectlCmd, lockArgs(vargs, "create", "--filename", lockPath)...)
+}
+
+// releaseLock deletes the deploy lock, warning if it can't.
+func releaseLock(runner *Environ, vargs GKE) {
+	err := runner.Run(vargs.KubectlCmd, lockArgs(vargs, "delete", "configmap", lockObjectName(vargs), "--ignore-not-found")...)
+	if err != nil {
+		runner.Printf("Warning: error releasing deploy lock: %s\n", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockManifest(t *testing.T) {
+	acquired := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: drone-gke-lock
+  annotations:
+    "drone-gke/acquired": "2017-06-01T12:00:00Z"
+    "drone-gke/build": "42"
+`, lockManifest(lockName, 42, acquired))
+}
+
+func TestLockObjectName(t *testing.T) {
+	assert.Equal(t, "drone-gke-lock", lockObjectName(GKE{Namespace: "web"}))
+	assert.Equal(t, "drone-gke-lock-web", lockObjectName(GKE{Namespace: "web", SystemNamespace: "drone-gke"}))
+	assert.Equal(t, "drone-gke-lock", lockObjectName(GKE{SystemNamespace: "drone-gke"}))
+}
+
+func TestLockArgs(t *testing.T) {
+	vargs := GKE{Namespace: "web", NamespaceMode: "inline"}
+	assert.Equal(t, []string{"get", "configmap", "--namespace", "web"}, lockArgs(vargs, "get", "configmap"))
+
+	vargs.SystemNamespace = "drone-gke"
+	assert.Equal(t, []string{"get", "configmap", "--namespace", "drone-gke"}, lockArgs(vargs, "get", "configmap"))
+}
+
+func TestLockHolder(t *testing.T) {
+	build, acquired, err := lockHolder([]byte(`{
+  "kind": "ConfigMap",
+  "metadata": {
+    "name": "drone-gke-lock",
+    "annotations": {
+      "drone-gke/acquired": "2017-06-01T12:00:00Z",
+      "drone-gke/build": "42"
+    }
+  }
+}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "42", build)
+		assert.Equal(t, time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC), acquired)
+	}
+
+	build, acquired, err = lockHolder([]byte(`{"metadata": {"annotations": {"drone-gke/build": "7", "drone-gke/acquired": "yesterday"}}}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "7", build)
+		assert.True(t, acquired.IsZero())
+	}
+
+	_, acquired, err = lockHolder([]byte(`{"metadata": {"annotations": {}}}`))
+	if assert.NoError(t, err) {
+		assert.True(t, acquired.IsZero())
+	}
+
+	_, _, err = lockHolder([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestAcquireLockWithoutAcquired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// The existing lock has no acquired annotation.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+case "$1" in
+get) echo '{"metadata": {"name": "drone-gke-lock", "annotations": {"drone-gke/build": "7"}}}' ;;
+esac
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	log := &bytes.Buffer{}
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{}).WithLog(log)
+	vargs := GKE{KubectlCmd: script, OutputDir: dir}
+
+	if assert.NoError(t, acquireLock(runner, vargs, 42, time.Hour)) {
+		assert.Contains(t, log.String(), `Warning: taking over the deploy lock from build "7", because its drone-gke/acquired annotation is missing or invalid`)
+		assert.Contains(t, log.String(), script+" delete configmap drone-gke-lock --ignore-not-found")
+		assert.Contains(t, log.String(), script+" create --filename")
+	}
+}
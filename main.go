@@ -1,19 +1,87 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/drone/drone-plugin-go/plugin"
 )
 
 type GKE struct {
+	// FromGCloudConfig fills the project, zone and region, if they aren't
+	// set, from the active gcloud configuration.
+	FromGCloudConfig bool `json:"from_gcloud_config"`
+
+	// PrintEffectiveConfig prints each of the vargs as resolved, and where it
+	// was set, then deploys unless PrintEffectiveConfigOnly is set.
+	PrintEffectiveConfig     bool `json:"print_effective_config"`
+	PrintEffectiveConfigOnly bool `json:"print_effective_config_only"`
+
+	// PrintCommands prints the gcloud and kubectl commands that would be run,
+	// without running them.
+	PrintCommands bool `json:"print_commands"`
+
+	// GCloudConfigDir holds a gcloud config directory (CLOUDSDK_CONFIG) for
+	// each build, removed when the plugin finishes.
+	GCloudConfigDir string `json:"gcloud_config_dir"`
+
+	// HTTPSProxy, HTTPProxy and NoProxy route gcloud and kubectl through an
+	// egress proxy.
+	HTTPSProxy string `json:"https_proxy"`
+	HTTPProxy  string `json:"http_proxy"`
+	NoProxy    string `json:"no_proxy"`
+
+	// ClusterCAFile is a CA certificate file to set on the cluster's kubeconfig
+	// entry, for clusters whose credentials don't include it.
+	ClusterCAFile string `json:"cluster_ca_file"`
+
+	// SkipAuth skips gcloud authentication and get-credentials, connecting
+	// kubectl to APIServer with ClusterToken instead, e.g. for clusters
+	// outside GKE.
+	SkipAuth     bool   `json:"skip_auth"`
+	APIServer    string `json:"api_server"`
+	ClusterToken string `json:"cluster_token"`
+
+	// NoColor disables color in gcloud and kubectl output, and strips any
+	// ANSI escape sequences that remain.
+	NoColor bool `json:"no_color"`
+
+	// ValuesDir holds a YAML file of vars for each environment
+	// (<environment>.yaml), used as defaults for Vars.
+	ValuesDir string `json:"values_dir"`
+
+	// VarsDefaults are defaults for Vars, and for the values in ValuesDir, so
+	// templates can rely on them being set with missingkey=error.
+	VarsDefaults map[string]interface{} `json:"vars_defaults"`
+
+	// CoerceVars converts string vars that look like booleans or numbers to
+	// them, so template conditionals treat "false" as false.
+	CoerceVars bool `json:"coerce_vars"`
+
+	// Strict turns warnings about missing optional inputs into errors.
+	Strict bool `json:"strict"`
+
+	// RunIf names a var that must be true for the plugin to deploy.
+	// Otherwise the plugin does nothing and succeeds.
+	RunIf string `json:"run_if"`
+
+	// Config is a YAML or JSON file of vargs, used as defaults for vargs
+	// that aren't set in the build configuration.
+	Config string `json:"config"`
+
 	DryRun         bool                   `json:"dry_run"`
 	Verbose        bool                   `json:"verbose"`
 	Token          string                 `json:"token"`
@@ -21,6 +89,7 @@ type GKE struct {
 	KubectlCmd     string                 `json:"kubectl_cmd"`
 	Project        string                 `json:"project"`
 	Zone           string                 `json:"zone"`
+	Region         string                 `json:"region"`
 	Cluster        string                 `json:"cluster"`
 	Namespace      string                 `json:"namespace"`
 	Template       string                 `json:"template"`
@@ -32,21 +101,359 @@ type GKE struct {
 	// thus don't need to be re-encoded as they would be if they were in
 	// the Secrets field.
 	SecretsBase64 map[string]string `json:"secrets_base64"`
+
+	// GSMSecrets maps secret vars to Google Secret Manager secret versions
+	// (projects/p/secrets/s/versions/v) to fetch them from, like Secrets.
+	GSMSecrets map[string]string `json:"gsm_secrets"`
+
+	// SecretFiles maps secret vars to files, relative to the workspace, to
+	// read them from, like Secrets.
+	SecretFiles map[string]string `json:"secret_files"`
+
+	// AllowSecretOverride lets a secret var be set by more than one source,
+	// taking the value from the first of Secrets, SecretsBase64, SecretFiles
+	// and GSMSecrets to set it.
+	AllowSecretOverride bool `json:"allow_secret_override"`
+
+	// MaxSecrets, if set, is the most secret vars there may be, from all of
+	// the sources.
+	MaxSecrets int `json:"max_secrets"`
+
+	// MissingKey sets the template missingkey option: error (the default),
+	// zero or default. TemplateMissingKey overrides it for specific templates.
+	MissingKey         string            `json:"missingkey"`
+	TemplateMissingKey map[string]string `json:"template_missingkey"`
+
+	// LeftDelim and RightDelim replace the {{ and }} template delimiters,
+	// for templates that contain them for other tools.
+	LeftDelim  string `json:"left_delim"`
+	RightDelim string `json:"right_delim"`
+
+	// ManifestHeader is rendered, with the same data as the template plus
+	// RENDER_TIME, as a comment at the top of each rendered non-secret template.
+	ManifestHeader string `json:"manifest_header"`
+
+	// TemplateSHA256 maps remote (http or https) template URLs to their
+	// expected SHA256, verified after they're downloaded.
+	TemplateSHA256 map[string]string `json:"template_sha256"`
+
+	// DeployTargetNamespaceMap maps Drone deploy targets (DRONE_DEPLOY_TO) to
+	// the namespace to use when Namespace isn't set.
+	DeployTargetNamespaceMap map[string]string `json:"deploy_target_namespace_map"`
+
+	// NamespaceLabels and NamespaceAnnotations are set on the namespace
+	// resource. Their values are rendered with the same data as the template.
+	NamespaceLabels      keyValues `json:"namespace_labels"`
+	NamespaceAnnotations keyValues `json:"namespace_annotations"`
+
+	// InjectLabels and InjectAnnotations are merged into the metadata of every
+	// rendered object before applying, so they're part of the applied config.
+	InjectLabels      keyValues `json:"inject_labels"`
+	InjectAnnotations keyValues `json:"inject_annotations"`
+
+	// ScaleNodePool is resized to NodePoolSize nodes before applying, and
+	// back to NodePoolRestoreSize (if non-zero) afterwards.
+	ScaleNodePool       string `json:"scale_node_pool"`
+	NodePoolSize        int    `json:"node_pool_size"`
+	NodePoolRestoreSize int    `json:"node_pool_restore_size"`
+
+	// ManifestDir is applied recursively as-is, instead of rendering the templates.
+	ManifestDir string `json:"manifest_dir"`
+
+	// KustomizeDir is built with `kubectl kustomize`, and the output is
+	// rendered in place of the template.
+	KustomizeDir string `json:"kustomize_dir"`
+
+	// HelmChart is rendered with `helm template`, as HelmRelease with the
+	// HelmValues files, and the output is rendered in place of the template,
+	// or used as is if HelmSkipRender is set.
+	HelmChart      string   `json:"helm_chart"`
+	HelmRelease    string   `json:"helm_release"`
+	HelmValues     []string `json:"helm_values"`
+	HelmSkipRender bool     `json:"helm_skip_render"`
+	HelmCmd        string   `json:"helm_cmd"`
+
+	// PolicyOutput is the file to write the rendered objects (excluding
+	// secrets) to as a JSON array, as input for policy checks.
+	PolicyOutput string `json:"policy_output"`
+
+	// DiffOutput is the file to write `kubectl diff` output to, with secret values redacted.
+	DiffOutput string `json:"diff_output"`
+
+	// Parallel deploys to multiple clusters concurrently, at most
+	// ParallelLimit at a time, with each cluster's output prefixed.
+	Parallel      bool `json:"parallel"`
+	ParallelLimit int  `json:"parallel_limit"`
+
+	// Context is the kubectl context to use for every command, defaulting
+	// to the one gcloud get-credentials creates for the cluster.
+	Context string `json:"context"`
+
+	// FanoutNamespaces is a comma-separated list of namespaces to apply the
+	// templates to in turn, in each cluster. The templates are rendered with
+	// Namespace, or, if FanoutRender is set, with each fanout namespace.
+	FanoutNamespaces string `json:"fanout_namespaces"`
+	FanoutRender     bool   `json:"fanout_render"`
+
+	// UniqueContext appends the build number to the context's name, and gives
+	// the build its own kubeconfig, for runners shared by concurrent builds.
+	UniqueContext bool `json:"unique_context"`
+
+	// As and AsGroup impersonate a Kubernetes user and groups for every
+	// kubectl command.
+	As      string   `json:"as"`
+	AsGroup []string `json:"as_group"`
+
+	// RequestTimeout is passed to each kubectl command that contacts the cluster.
+	RequestTimeout string `json:"request_timeout"`
+
+	// SecretKeyMap makes secrets available in the secret template under
+	// additional keys, e.g. {"DB_PASSWORD": "db-password"}.
+	SecretKeyMap map[string]string `json:"secret_key_map"`
+
+	// SecretRenderOut is where to copy the rendered secret template, for
+	// review in controlled environments. It contains the secrets.
+	SecretRenderOut string `json:"secret_render_out"`
+
+	// LintImages warns about containers with untagged or latest images, or
+	// without an explicit imagePullPolicy (errors if Strict is set).
+	LintImages bool `json:"lint_images"`
+
+	// VerifyImages checks that the containers' images in Container Registry
+	// and Artifact Registry exist before applying.
+	VerifyImages bool `json:"verify_images"`
+
+	// OfflineSchema is a saved OpenAPI schema to validate the rendered objects
+	// against, without authenticating or contacting the cluster. It implies
+	// DryRun and SchemaValidate.
+	OfflineSchema string `json:"offline_schema"`
+
+	// SchemaValidate validates the rendered objects against the cluster's
+	// OpenAPI schema before applying.
+	SchemaValidate bool `json:"schema_validate"`
+
+	// Preview prints a diff between the live objects and a server-side dry run
+	// of the rendered template (the secret template is omitted).
+	Preview bool `json:"preview"`
+
+	// ImageDigestFile is a file with the digest of an image built earlier in
+	// the pipeline, available to the template as IMAGE_DIGEST, and with
+	// ImageRepo as IMAGE (`<image_repo>@<digest>`).
+	ImageDigestFile string `json:"image_digest_file"`
+	ImageRepo       string `json:"image_repo"`
+
+	// CreatePullSecret applies an image pull secret named PullSecretName to
+	// the namespace, authenticating to PullSecretRegistries with the token.
+	CreatePullSecret     bool     `json:"create_pull_secret"`
+	PullSecretName       string   `json:"pull_secret_name"`
+	PullSecretRegistries []string `json:"pull_secret_registries"`
+
+	// StageName and StepName identify the pipeline stage and step running the
+	// deploy, defaulting to DRONE_STAGE_NAME and DRONE_STEP_NAME.
+	StageName string `json:"stage_name"`
+	StepName  string `json:"step_name"`
+
+	// ChangeSummary prints the objects with PruneLabel that the deploy adds,
+	// removes and keeps, by comparing the live objects with a server-side
+	// dry run.
+	ChangeSummary bool `json:"change_summary"`
+
+	// NoTemplate applies the template and secret template as is, without
+	// rendering them, ignoring any secrets.
+	NoTemplate bool `json:"no_template"`
+
+	// TemplateOnly renders only the template, ignoring the secret template
+	// and any secrets, e.g. to validate manifests in a job without secrets.
+	TemplateOnly bool `json:"template_only"`
+
+	// TargetFile lists the cluster coordinates of named deploy environments.
+	// Target selects one of them, defaulting to the Drone deploy target.
+	TargetFile string `json:"target_file"`
+	Target     string `json:"target"`
+
+	// KeepRendered leaves the rendered templates and namespace resource file
+	// in the output directory after the plugin finishes, for debugging.
+	KeepRendered bool `json:"keep_rendered"`
+
+	// ApplyOrderFile lists the templates (or rendered files) to apply one at
+	// a time, in order. Unlisted templates are applied afterwards, or are an
+	// error if ApplyOrderStrict is set.
+	ApplyOrderFile   string `json:"apply_order_file"`
+	ApplyOrderStrict bool   `json:"apply_order_strict"`
+
+	// Kinds limits the objects applied to those of the given kinds, and
+	// ExcludeKinds to those not of the given kinds.
+	Kinds        []string `json:"kinds"`
+	ExcludeKinds []string `json:"exclude_kinds"`
+
+	// DeployLock holds a lock (a ConfigMap) in the namespace while deploying,
+	// failing if another build holds it. Locks older than LockTimeout are
+	// taken over.
+	DeployLock  bool   `json:"deploy_lock"`
+	LockTimeout string `json:"lock_timeout"`
+
+	// FailIfUnchanged fails the deploy if kubectl reports every object as
+	// unchanged, e.g. to check that a promotion did something.
+	FailIfUnchanged bool `json:"fail_if_unchanged"`
+
+	// SystemNamespace holds the deploy lock instead of the namespace, to keep
+	// the plugin's bookkeeping objects in one place.
+	SystemNamespace string `json:"system_namespace"`
+
+	// WaitAll waits for the rollout of each Deployment, StatefulSet and
+	// DaemonSet in the manifests, for up to RolloutTimeout each.
+	WaitAll        bool   `json:"wait_all"`
+	RolloutTimeout string `json:"rollout_timeout"`
+
+	// WaitCondition lists objects, like `certificate/web=Ready`, to wait for
+	// the condition of after applying, for up to WaitConditionTimeout in all.
+	WaitCondition        []string `json:"wait_condition"`
+	WaitConditionTimeout string   `json:"wait_condition_timeout"`
+
+	// WatchEvents prints the namespace's warning events after applying and
+	// waiting, or when waiting fails.
+	WatchEvents bool `json:"watch_events"`
+
+	// SmokeTestTemplate is a Job template, rendered like the template, that's
+	// run after deploying. The deploy fails if it doesn't complete within
+	// SmokeTestTimeout.
+	SmokeTestTemplate string `json:"smoke_test_template"`
+	SmokeTestTimeout  string `json:"smoke_test_timeout"`
+
+	// AnnotateProvenance annotates the namespace with the build, commit and
+	// branch after a successful deploy.
+	AnnotateProvenance bool `json:"annotate_provenance"`
+
+	// ManifestIndex is written with each manifest applied to each cluster,
+	// the template it was rendered from, and its SHA256.
+	ManifestIndex string `json:"manifest_index"`
+
+	// Timing prints how long each phase took at the end of the run, and adds
+	// the durations to the result file.
+	Timing bool `json:"timing"`
+
+	// ResultFile is written with whether the deploy succeeded and the exit
+	// code of each phase's command, for later pipeline steps.
+	ResultFile string `json:"result_file"`
+
+	// ServerSide applies with server-side apply. ReportConflicts prints the
+	// field managers that own conflicting fields when it fails.
+	ServerSide      bool `json:"server_side"`
+	ReportConflicts bool `json:"report_conflicts"`
+
+	// TakeOwnership lists kinds whose objects are force applied before the
+	// apply, to take over their fields from other field managers.
+	TakeOwnership []string `json:"take_ownership"`
+
+	// ReplaceTemplates are applied with kubectl replace (or create, for
+	// objects that don't exist), instead of kubectl apply.
+	ReplaceTemplates []string `json:"replace_templates"`
+
+	// Overwrite, if false, fails the apply instead of overwriting fields
+	// changed on the live objects (kubectl apply --overwrite=false).
+	Overwrite *bool `json:"overwrite"`
+
+	// ContinueOnError keeps applying the rest of the ordered files after one
+	// fails, and reports all of the failures at the end.
+	ContinueOnError bool `json:"continue_on_error"`
+
+	// EnsureNamespaces are created, like the namespace, before applying.
+	EnsureNamespaces []string `json:"ensure_namespaces"`
+
+	// NamespaceMode is how the namespace is applied to kubectl commands: by
+	// setting it on the context (the default), inline with --namespace on
+	// every command, or both.
+	NamespaceMode string `json:"namespace_mode"`
+
+	// NamespacePrefix and NamespaceSuffix are added to the namespace.
+	NamespacePrefix string `json:"namespace_prefix"`
+	NamespaceSuffix string `json:"namespace_suffix"`
+
+	// OutputDir is where the rendered templates are written, named by
+	// rendering OutputNameTemplate.
+	OutputDir          string `json:"output_dir"`
+	OutputNameTemplate string `json:"output_name_template"`
+
+	// Environment replaces the {{env}} placeholder in the template paths,
+	// defaulting to the Drone deploy target.
+	Environment string `json:"environment"`
+
+	// Prune deletes objects in the namespace with PruneLabel that are no
+	// longer in the manifests. PruneWhitelist limits the resources considered.
+	Prune          bool     `json:"prune"`
+	PruneLabel     string   `json:"prune_label"`
+	PruneWhitelist []string `json:"prune_whitelist"`
+
+	// PruneCascade is how pruned objects' dependents are deleted:
+	// background, foreground or orphan.
+	PruneCascade string `json:"prune_cascade"`
+
+	// PruneIfChanged only prunes when the rendered manifests differ from the
+	// previous deploy, as recorded by their hash in StateFile.
+	PruneIfChanged bool   `json:"prune_if_changed"`
+	StateFile      string `json:"state_file"`
+
+	// RecreateOnImmutable replaces objects (deleting and recreating them) when
+	// applying fails because of an immutable field change. Only the kinds in
+	// RecreateKinds are recreated.
+	RecreateOnImmutable bool     `json:"recreate_on_immutable"`
+	RecreateKinds       []string `json:"recreate_kinds"`
+
+	// ApplyRetries is how many times to retry applying after a transient API server error.
+	ApplyRetries int `json:"apply_retries"`
+
+	// ConflictRetries is how many times to apply again after an object was
+	// modified between kubectl reading and writing it.
+	ConflictRetries int `json:"conflict_retries"`
+
+	// RetryBase, RetryMax and RetryFactor configure the exponential backoff
+	// between ApplyRetries.
+	RetryBase   string  `json:"retry_base"`
+	RetryMax    string  `json:"retry_max"`
+	RetryFactor float64 `json:"retry_factor"`
+
+	// VerifyDeployedImage is the image VerifyDeployment (namespace/name or
+	// name) is expected to use after applying, for its only container or
+	// VerifyContainer.
+	VerifyDeployedImage string `json:"verify_deployed_image"`
+	VerifyDeployment    string `json:"verify_deployment"`
+	VerifyContainer     string `json:"verify_container"`
+
+	// WaitLBService is a Service (namespace/name) to wait for a load balancer
+	// IP for after applying. The IP is written to LBOutputFile as LBOutputKey.
+	WaitLBService string `json:"wait_lb_service"`
+	LBTimeout     string `json:"lb_timeout"`
+	LBOutputFile  string `json:"lb_output_file"`
+	LBOutputKey   string `json:"lb_output_key"`
+
+	// CanaryWeight is available to the template as CANARY_WEIGHT. If
+	// CanaryIngress is set, it's annotated with the weight after applying.
+	CanaryWeight  *int   `json:"canary_weight"`
+	CanaryIngress string `json:"canary_ingress"`
+
+	// ChangeCause is available to the template as CHANGE_CAUSE, for the
+	// kubernetes.io/change-cause annotation.
+	ChangeCause string `json:"change_cause"`
+
+	// Default resource requests and limits, available to the template.
+	DefaultCPURequest    string `json:"default_cpu_request"`
+	DefaultMemoryRequest string `json:"default_memory_request"`
+	DefaultCPULimit      string `json:"default_cpu_limit"`
+	DefaultMemoryLimit   string `json:"default_memory_limit"`
+
+	// DefaultNodeSelector is available to the template, for pod specs to
+	// place their pods on dedicated node pools.
+	DefaultNodeSelector keyValues `json:"default_node_selector"`
 }
 
 var (
 	rev string
 )
 
-var nsTemplate = `
----
-apiVersion: v1
-kind: Namespace
-metadata:
-  name: %s
-`
-
 func main() {
+	// Seed the jitter of retries, so builds don't retry in step.
+	rand.Seed(time.Now().UnixNano())
+
 	err := wrapMain()
 	if err != nil {
 		fmt.Println(err)
@@ -54,7 +461,7 @@ func main() {
 	}
 }
 
-func wrapMain() error {
+func wrapMain() (err error) {
 	if rev == "" {
 		rev = "[unknown]"
 	}
@@ -66,253 +473,2177 @@ func wrapMain() error {
 	repo := plugin.Repo{}
 	build := plugin.Build{}
 	system := plugin.System{}
-	vargs := GKE{}
+	rawVargs := json.RawMessage{}
 
 	plugin.Param("workspace", &workspace)
 	plugin.Param("repo", &repo)
 	plugin.Param("build", &build)
 	plugin.Param("system", &system)
-	plugin.Param("vargs", &vargs)
+	plugin.Param("vargs", &rawVargs)
 	plugin.MustParse()
 
-	// Check required params.
+	vargs, err := parseVargs(rawVargs, workspace.Path)
+	if err != nil {
+		return err
+	}
 
-	if vargs.Token == "" {
-		return fmt.Errorf("Missing required param: token")
+	if vargs.PrintEffectiveConfigOnly {
+		vargs.PrintEffectiveConfig = true
 	}
 
-	if vargs.Project == "" {
-		vargs.Project = getProjectFromToken(vargs.Token)
+	// Record where each of the vargs came from, to print the effective config.
+	sources := map[string]string{}
+	if vargs.PrintEffectiveConfig {
+		sources, err = vargsSources(rawVargs, workspace.Path, vargs.Config)
+		if err != nil {
+			return fmt.Errorf("Error reading vargs sources: %s\n", err)
+		}
 	}
 
-	if vargs.Project == "" {
-		return fmt.Errorf("Missing required param: project")
+	res := &result{}
+	if vargs.ResultFile != "" {
+		defer func() {
+			werr := res.write(filepath.Join(workspace.Path, vargs.ResultFile), err)
+			if werr != nil {
+				fmt.Printf("Warning: error writing result file: %s\n", werr)
+			}
+		}()
 	}
 
-	if vargs.Zone == "" {
-		return fmt.Errorf("Missing required param: zone")
+	if vargs.Timing {
+		res.timing = true
+		defer res.printTimings(os.Stdout)
 	}
 
-	sdkPath := "/google-cloud-sdk"
-	keyPath := "/tmp/gcloud.json"
+	index := &manifestIndex{}
+	if vargs.ManifestIndex != "" {
+		defer func() {
+			werr := index.write(filepath.Join(workspace.Path, vargs.ManifestIndex))
+			if werr != nil {
+				fmt.Printf("Warning: error writing manifest index: %s\n", werr)
+			}
+		}()
+	}
 
-	// Defaults.
+	if vargs.TargetFile != "" {
+		if vargs.Target == "" {
+			vargs.Target = build.Deploy
+		}
 
-	if vargs.GCloudCmd == "" {
-		vargs.GCloudCmd = fmt.Sprintf("%s/bin/gcloud", sdkPath)
-	}
+		if vargs.Target == "" {
+			return fmt.Errorf("Missing required param: target (when target_file is set)")
+		}
 
-	if vargs.KubectlCmd == "" {
-		vargs.KubectlCmd = fmt.Sprintf("%s/bin/kubectl", sdkPath)
-	}
+		t, err := loadTarget(filepath.Join(workspace.Path, vargs.TargetFile), vargs.Target)
+		if err != nil {
+			return err
+		}
 
-	if vargs.Template == "" {
-		vargs.Template = ".kube.yml"
-	}
+		fmt.Printf("Using target %s from %s\n", vargs.Target, vargs.TargetFile)
+		untargeted := vargs
+		applyTarget(&vargs, t)
 
-	if vargs.SecretTemplate == "" {
-		vargs.SecretTemplate = ".kube.sec.yml"
+		if vargs.PrintEffectiveConfig {
+			targeted, err := changedVargs(untargeted, vargs)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+			for _, k := range targeted {
+				sources[k] = "target_file"
+			}
+		}
 	}
 
-	// Trim whitespace, to forgive the vagaries of YAML parsing.
-	vargs.Token = strings.TrimSpace(vargs.Token)
-
-	// Write credentials to tmp file to be picked up by the 'gcloud' command.
-	// This is inside the ephemeral plugin container, not on the host.
-	err := ioutil.WriteFile(keyPath, []byte(vargs.Token), 0600)
-	if err != nil {
-		return fmt.Errorf("Error writing token file: %s\n", err)
+	if vargs.Environment == "" {
+		vargs.Environment = build.Deploy
 	}
 
-	// Warn if the keyfile can't be deleted, but don't abort.
-	// We're almost certainly running inside an ephemeral container, so the file will be discarded when we're finished anyway.
-	defer func() {
-		err := os.Remove(keyPath)
-		if err != nil {
-			fmt.Printf("Warning: error removing token file: %s\n", err)
+	// Map the deploy target to a namespace, unless one is set explicitly.
+	if len(vargs.DeployTargetNamespaceMap) > 0 && vargs.Namespace == "" {
+		ns, ok := vargs.DeployTargetNamespaceMap[build.Deploy]
+		if !ok {
+			return fmt.Errorf("Error: deploy target %q isn't in deploy_target_namespace_map, and namespace isn't set\n", build.Deploy)
 		}
-	}()
 
-	e := os.Environ()
-	e = append(e, fmt.Sprintf("GOOGLE_APPLICATION_CREDENTIALS=%s", keyPath))
-	runner := NewEnviron(workspace.Path, e, os.Stdout, os.Stderr)
-
-	err = runner.Run(vargs.GCloudCmd, "auth", "activate-service-account", "--key-file", keyPath)
-	if err != nil {
-		return fmt.Errorf("Error: %s\n", err)
+		fmt.Printf("Using namespace %s for deploy target %s\n", ns, build.Deploy)
+		vargs.Namespace = ns
 	}
 
-	err = runner.Run(vargs.GCloudCmd, "container", "clusters", "get-credentials", vargs.Cluster, "--project", vargs.Project, "--zone", vargs.Zone)
-	if err != nil {
-		return fmt.Errorf("Error: %s\n", err)
+	// Drone 1.x exposes the pipeline stage and step to plugins only through the environment.
+	if vargs.StageName == "" {
+		vargs.StageName = os.Getenv("DRONE_STAGE_NAME")
+	}
+	if vargs.StepName == "" {
+		vargs.StepName = os.Getenv("DRONE_STEP_NAME")
 	}
 
-	data := map[string]interface{}{
-		// http://readme.drone.io/usage/variables/#string-interpolation:2b8b8ac4006be88c769f5e3fd99b009a
-		"BUILD_NUMBER": build.Number,
-		"COMMIT":       build.Commit,
-		"BRANCH":       build.Branch,
-		"TAG":          "", // How?
+	if vargs.ValuesDir != "" {
+		var values map[string]interface{}
+		if vargs.Environment != "" {
+			values, err = loadValues(filepath.Join(workspace.Path, vargs.ValuesDir), vargs.Environment)
+			if err != nil {
+				return err
+			}
+		}
 
-		// https://godoc.org/github.com/drone/drone-plugin-go/plugin#Workspace
-		"workspace": workspace,
-		"repo":      repo,
-		"build":     build,
-		"system":    system,
+		if values == nil {
+			msg := fmt.Sprintf("no values file for environment %q in %s", vargs.Environment, vargs.ValuesDir)
+			if vargs.Strict {
+				return fmt.Errorf("Error: %s\n", msg)
+			}
+			fmt.Printf("Warning: %s\n", msg)
+		}
 
-		// Misc useful stuff.
-		// Note that we don't include all of the vargs, since that includes the GCP token.
-		"project":   vargs.Project,
-		"zone":      vargs.Zone,
-		"cluster":   vargs.Cluster,
-		"namespace": vargs.Namespace,
+		vargs.Vars = mergeValues(vargs.Vars, values)
 	}
 
-	for k, v := range vargs.Vars {
-		// Don't allow vars to be overridden.
-		// We do this to ensure that the built-in template vars (above) can be relied upon.
-		if _, ok := data[k]; ok {
-			return fmt.Errorf("Error: var %q shadows existing var\n", k)
-		}
+	if len(vargs.VarsDefaults) > 0 {
+		vargs.Vars = mergeValues(vargs.Vars, vargs.VarsDefaults)
+	}
 
-		data[k] = v
+	if vargs.CoerceVars {
+		vargs.Vars = coerceVars(vargs.Vars)
 	}
 
-	if vargs.Verbose {
-		dump := data
-		delete(dump, "workspace")
-		dumpData(os.Stdout, "DATA (Workspace Values Omitted)", dump)
+	if vargs.ImageRepo != "" && vargs.ImageDigestFile == "" {
+		return fmt.Errorf("Missing required param: image_digest_file (when image_repo is set)")
 	}
 
-	secrets := map[string]interface{}{}
-	for k, v := range vargs.Secrets {
-		if v == "" {
-			return fmt.Errorf("Error: secret var %q is an empty string\n", k)
+	var imageDigest string
+	if vargs.ImageDigestFile != "" {
+		imageDigest, err = readImageDigest(filepath.Join(workspace.Path, vargs.ImageDigestFile))
+		if err != nil {
+			return fmt.Errorf("Error reading image digest file: %s\n", err)
 		}
-
-		// Base64 encode secret strings.
-		secrets[k] = base64.StdEncoding.EncodeToString([]byte(v))
 	}
-	for k, v := range vargs.SecretsBase64 {
-		if _, ok := secrets[k]; ok {
-			return fmt.Errorf("Error: secret var %q is already set in Secrets\n", k)
+
+	if vargs.RunIf != "" {
+		v, ok := vargs.Vars[vargs.RunIf]
+		if !ok {
+			return fmt.Errorf("Error: run_if var %q is not set in vars\n", vargs.RunIf)
 		}
-		if v == "" {
-			return fmt.Errorf("Error: secret var %q is an empty string\n", k)
+
+		if !isTruthy(v) {
+			fmt.Printf("Skipping deploy, because run_if var %q is %v\n", vargs.RunIf, v)
+			return nil
 		}
-		// Don't base64 encode these secrets, they already are.
-		secrets[k] = v
 	}
 
-	mapping := map[string]map[string]interface{}{
-		vargs.Template:       data,
-		vargs.SecretTemplate: secrets,
-	}
+	// Check required params.
 
-	outPaths := make(map[string]string)
-	pathArg := []string{}
+	if vargs.SkipAuth {
+		if vargs.APIServer == "" {
+			return fmt.Errorf("Missing required param: api_server (when skip_auth is set)")
+		}
 
-	for t, content := range mapping {
-		if t == "" {
-			continue
+		if vargs.ClusterToken == "" {
+			return fmt.Errorf("Missing required param: cluster_token (when skip_auth is set)")
 		}
 
-		inPath := filepath.Join(workspace.Path, t)
-		bn := filepath.Base(inPath)
+		if vargs.OfflineSchema != "" {
+			return fmt.Errorf("Error: only one of skip_auth and offline_schema may be set")
+		}
 
-		// Ensure the required template file exists.
-		_, err := os.Stat(inPath)
-		if os.IsNotExist(err) {
-			if t == vargs.Template {
-				return fmt.Errorf("Error finding template: %s\n", err)
-			} else {
-				fmt.Printf("Warning: skipping optional template %s, it was not found\n", t)
-				continue
-			}
+		// These need gcloud to be authenticated.
+		if vargs.FromGCloudConfig || len(vargs.GSMSecrets) > 0 || vargs.ScaleNodePool != "" || vargs.VerifyImages || vargs.CreatePullSecret {
+			return fmt.Errorf("Error: from_gcloud_config, gsm_secrets, scale_node_pool, verify_images and create_pull_secret can't be used with skip_auth")
+		}
+	} else if vargs.OfflineSchema != "" {
+		if vargs.APIServer != "" || vargs.ClusterToken != "" {
+			return fmt.Errorf("Error: api_server and cluster_token require skip_auth")
 		}
 
-		// Generate the file.
-		blob, err := ioutil.ReadFile(inPath)
-		if err != nil {
-			return fmt.Errorf("Error reading template: %s\n", err)
+		// Nothing contacts the cluster, or Google Cloud.
+		if vargs.FromGCloudConfig || len(vargs.GSMSecrets) > 0 || vargs.VerifyImages || vargs.DiffOutput != "" || vargs.Preview || vargs.ChangeSummary || vargs.UniqueContext || vargs.ClusterCAFile != "" {
+			return fmt.Errorf("Error: from_gcloud_config, gsm_secrets, verify_images, diff_output, preview, change_summary, unique_context and cluster_ca_file can't be used with offline_schema")
 		}
 
-		tmpl, err := template.New(bn).Option("missingkey=error").Parse(string(blob))
-		if err != nil {
-			return fmt.Errorf("Error parsing template: %s\n", err)
+		if vargs.Project == "" && vargs.Token != "" {
+			vargs.Project = getProjectFromToken(vargs.Token)
 		}
 
-		outPaths[t] = fmt.Sprintf("/tmp/%s", bn)
-		f, err := os.Create(outPaths[t])
-		if err != nil {
-			return fmt.Errorf("Error creating deployment file: %s\n", err)
+		vargs.DryRun = true
+		vargs.SchemaValidate = true
+	} else {
+		if vargs.APIServer != "" || vargs.ClusterToken != "" {
+			return fmt.Errorf("Error: api_server and cluster_token require skip_auth")
 		}
 
-		err = tmpl.Execute(f, content)
-		if err != nil {
-			return fmt.Errorf("Error executing deployment template: %s\n", err)
+		if vargs.Token == "" {
+			return fmt.Errorf("Missing required param: token")
 		}
 
-		f.Close()
+		// Say where the project came from, since a mistyped project is easy to miss.
+		tokenProject := getProjectFromToken(vargs.Token)
+		if vargs.Project == "" {
+			vargs.Project = tokenProject
+			if vargs.Project != "" {
+				fmt.Printf("Using project %s, inferred from the token\n", vargs.Project)
+			}
+		} else if tokenProject != "" && tokenProject != vargs.Project {
+			fmt.Printf("Using project %s, set explicitly (the token's project is %s)\n", vargs.Project, tokenProject)
+		} else {
+			fmt.Printf("Using project %s, set explicitly\n", vargs.Project)
+		}
 
-		pathArg = append(pathArg, outPaths[t])
+		// With from_gcloud_config, the project and location are checked after authenticating.
+		if !vargs.FromGCloudConfig {
+			if err := checkLocation(vargs); err != nil {
+				return err
+			}
+		}
 	}
 
-	if vargs.Verbose {
-		dumpFile(os.Stdout, "DEPLOYMENT (Secret Template Omitted)", outPaths[vargs.Template])
+	clusters := splitList(vargs.Cluster)
+	namespaces, err := clusterNamespaces(clusters, vargs.Namespace)
+	if err != nil {
+		return err
 	}
 
-	if vargs.DryRun {
-		fmt.Println("Skipping kubectl apply, because dry_run: true")
-		return nil
+	if vargs.NamespaceMode == "" {
+		vargs.NamespaceMode = "context"
 	}
 
-	// Set the execution namespace.
-	if len(vargs.Namespace) > 0 {
-		fmt.Printf("Configuring kubectl to the %s namespace\n", vargs.Namespace)
+	if !namespaceModes[vargs.NamespaceMode] {
+		return fmt.Errorf("Error: namespace_mode must be context, inline or both, not %q\n", vargs.NamespaceMode)
+	}
 
-		context := strings.Join([]string{"gke", vargs.Project, vargs.Zone, vargs.Cluster}, "_")
+	if vargs.ParallelLimit == 0 {
+		vargs.ParallelLimit = 4
+	}
 
-		err = runner.Run(vargs.KubectlCmd, "config", "set-context", context, "--namespace", vargs.Namespace)
-		if err != nil {
-			return fmt.Errorf("Error: %s\n", err)
-		}
+	if vargs.ParallelLimit < 0 {
+		return fmt.Errorf("Error: parallel_limit must be positive")
+	}
+
+	// Clusters deployed in parallel would overwrite each other's files.
+	if vargs.Parallel && (vargs.PolicyOutput != "" || vargs.DiffOutput != "" || vargs.SecretRenderOut != "") {
+		return fmt.Errorf("Error: policy_output, diff_output and secret_render_out can't be used with parallel")
+	}
 
-		resource := fmt.Sprintf(nsTemplate, vargs.Namespace)
-		nsPath := "/tmp/namespace.json"
+	if vargs.MaxSecrets < 0 {
+		return fmt.Errorf("Error: max_secrets can't be negative")
+	}
 
-		// Write namespace resource file to tmp file to be picked up by the 'kubectl' command.
-		// This is inside the ephemeral plugin container, not on the host.
-		err := ioutil.WriteFile(nsPath, []byte(resource), 0600)
-		if err != nil {
-			return fmt.Errorf("Error writing namespace resource file: %s\n", err)
+	if vargs.CreatePullSecret {
+		if vargs.PullSecretName == "" {
+			vargs.PullSecretName = defaultPullSecretName
 		}
 
-		// Ensure the namespace exists, without errors (unlike `kubectl create namespace`).
-		err = runner.Run(vargs.KubectlCmd, "apply", "--filename", nsPath)
-		if err != nil {
-			return fmt.Errorf("Error: %s\n", err)
+		if err := validateDNSSubdomain(vargs.PullSecretName); err != nil {
+			return fmt.Errorf("Error: pull_secret_name %q is invalid: %s\n", vargs.PullSecretName, err)
+		}
+
+		if len(vargs.PullSecretRegistries) == 0 {
+			vargs.PullSecretRegistries = defaultPullSecretRegistries
 		}
+	} else if vargs.PullSecretName != "" || len(vargs.PullSecretRegistries) > 0 {
+		return fmt.Errorf("Error: pull_secret_name and pull_secret_registries require create_pull_secret")
 	}
 
-	// Apply Kubernetes configuration files.
-	err = runner.Run(vargs.KubectlCmd, "apply", "--filename", strings.Join(pathArg, ","))
-	if err != nil {
-		return fmt.Errorf("Error: %s\n", err)
+	if vargs.VerifyDeployedImage != "" && vargs.VerifyDeployment == "" {
+		return fmt.Errorf("Missing required param: verify_deployment (when verify_deployed_image is set)")
 	}
 
-	return nil
-}
+	if (vargs.VerifyDeployment != "" || vargs.VerifyContainer != "") && vargs.VerifyDeployedImage == "" {
+		return fmt.Errorf("Error: verify_deployment and verify_container require verify_deployed_image")
+	}
 
-type token struct {
-	ProjectID string `json:"project_id"`
-}
+	if len(vargs.AsGroup) > 0 && vargs.As == "" {
+		return fmt.Errorf("Missing required param: as (when as_group is set)")
+	}
 
-func getProjectFromToken(j string) string {
-	t := token{}
-	err := json.Unmarshal([]byte(j), &t)
+	// Values of the namespace labels and annotations are templates, only validated once rendered.
+	vargs.NamespaceLabels, err = normalizeKeyValues("namespace_labels", vargs.NamespaceLabels, nil)
 	if err != nil {
-		return ""
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	vargs.NamespaceAnnotations, err = normalizeKeyValues("namespace_annotations", vargs.NamespaceAnnotations, nil)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	vargs.InjectLabels, err = normalizeKeyValues("inject_labels", vargs.InjectLabels, validateLabelValue)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	vargs.InjectAnnotations, err = normalizeKeyValues("inject_annotations", vargs.InjectAnnotations, nil)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	if (len(vargs.InjectLabels) > 0 || len(vargs.InjectAnnotations) > 0) && vargs.ManifestDir != "" {
+		return fmt.Errorf("Error: inject_labels and inject_annotations can't be used with manifest_dir")
+	}
+
+	vargs.DefaultNodeSelector, err = normalizeKeyValues("default_node_selector", vargs.DefaultNodeSelector, validateLabelValue)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	for _, p := range []struct{ name, value string }{
+		{"https_proxy", vargs.HTTPSProxy},
+		{"http_proxy", vargs.HTTPProxy},
+	} {
+		if p.value == "" {
+			continue
+		}
+		u, err := url.Parse(p.value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Error: %s must be a URL, like http://proxy:3128\n", p.name)
+		}
+	}
+
+	if vargs.ClusterCAFile != "" {
+		if _, err := os.Stat(filepath.Join(workspace.Path, vargs.ClusterCAFile)); err != nil {
+			return fmt.Errorf("Error finding cluster CA file: %s\n", err)
+		}
+	}
+
+	if vargs.GCloudConfigDir != "" && !filepath.IsAbs(vargs.GCloudConfigDir) {
+		return fmt.Errorf("Error: gcloud_config_dir must be an absolute path")
+	}
+
+	if vargs.Context != "" && len(clusters) > 1 {
+		return fmt.Errorf("Error: context can't be used with more than one cluster")
+	}
+
+	if vargs.Context != "" && vargs.UniqueContext {
+		return fmt.Errorf("Error: context can't be used with unique_context")
+	}
+
+	if vargs.SkipAuth && len(clusters) > 1 {
+		return fmt.Errorf("Error: skip_auth can't be used with more than one cluster")
+	}
+
+	for i, ns := range namespaces {
+		if ns == "" {
+			continue
+		}
+
+		namespaces[i], err = transformNamespace(ns, vargs.NamespacePrefix, vargs.NamespaceSuffix)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ns := range vargs.EnsureNamespaces {
+		if err := validateDNSLabel(ns); err != nil {
+			return fmt.Errorf("Error: ensure_namespaces entry %q is invalid: %s\n", ns, err)
+		}
+	}
+
+	if vargs.RequestTimeout != "" {
+		if err := validateRequestTimeout(vargs.RequestTimeout); err != nil {
+			return err
+		}
+	}
+
+	fanout, err := fanoutNamespaces(vargs.FanoutNamespaces, vargs.NamespacePrefix, vargs.NamespaceSuffix)
+	if err != nil {
+		return err
+	}
+
+	if len(fanout) > 0 {
+		if len(splitList(vargs.Namespace)) > 1 {
+			return fmt.Errorf("Error: namespace can't be a list with fanout_namespaces")
+		}
+
+		// With fanout_render, each namespace gets the cluster's credentials
+		// again, which a renamed context would collide with.
+		if vargs.UniqueContext && vargs.FanoutRender {
+			return fmt.Errorf("Error: unique_context can't be used with fanout_render")
+		}
+	} else if vargs.FanoutRender {
+		return fmt.Errorf("Missing required param: fanout_namespaces (when fanout_render is set)")
+	}
+
+	if vargs.Prune {
+		pruneNamespaces := namespaces
+		if len(fanout) > 0 {
+			pruneNamespaces = fanout
+		}
+
+		for _, ns := range pruneNamespaces {
+			pv := vargs
+			pv.Namespace = ns
+			if err := validatePrune(pv); err != nil {
+				return err
+			}
+		}
+	}
+
+	if vargs.KustomizeDir != "" && vargs.ManifestDir != "" {
+		return fmt.Errorf("Error: only one of kustomize_dir and manifest_dir may be set")
+	}
+
+	if vargs.HelmChart != "" && (vargs.KustomizeDir != "" || vargs.ManifestDir != "") {
+		return fmt.Errorf("Error: helm_chart can't be used with kustomize_dir or manifest_dir")
+	}
+
+	if vargs.HelmChart == "" && (vargs.HelmRelease != "" || len(vargs.HelmValues) > 0 || vargs.HelmSkipRender) {
+		return fmt.Errorf("Missing required param: helm_chart (when helm_release, helm_values or helm_skip_render is set)")
+	}
+
+	if vargs.ApplyOrderFile != "" && vargs.ManifestDir != "" {
+		return fmt.Errorf("Error: apply_order_file can't be used with manifest_dir")
+	}
+
+	// Each apply would prune the objects from the others.
+	if vargs.ApplyOrderFile != "" && vargs.Prune {
+		return fmt.Errorf("Error: apply_order_file can't be used with prune")
+	}
+
+	if len(vargs.Kinds) > 0 && len(vargs.ExcludeKinds) > 0 {
+		return fmt.Errorf("Error: only one of kinds and exclude_kinds may be set")
+	}
+
+	if len(vargs.Kinds) > 0 || len(vargs.ExcludeKinds) > 0 {
+		if vargs.ManifestDir != "" {
+			return fmt.Errorf("Error: kinds and exclude_kinds can't be used with manifest_dir")
+		}
+
+		// Pruning would delete the objects that were filtered out.
+		if vargs.Prune {
+			return fmt.Errorf("Error: kinds and exclude_kinds can't be used with prune")
+		}
+	}
+
+	if len(vargs.ReplaceTemplates) > 0 && (vargs.Prune || vargs.ManifestDir != "") {
+		return fmt.Errorf("Error: replace_templates can't be used with prune or manifest_dir")
+	}
+
+	if vargs.ReportConflicts && !vargs.ServerSide {
+		return fmt.Errorf("Missing required param: server_side (when report_conflicts is set)")
+	}
+
+	if vargs.ContinueOnError && vargs.ApplyOrderFile == "" {
+		return fmt.Errorf("Missing required param: apply_order_file (when continue_on_error is set)")
+	}
+
+	if vargs.RecreateOnImmutable && len(vargs.RecreateKinds) == 0 {
+		return fmt.Errorf("Missing required param: recreate_kinds (when recreate_on_immutable is set)")
+	}
+
+	if vargs.CanaryWeight != nil && (*vargs.CanaryWeight < 0 || *vargs.CanaryWeight > 100) {
+		return fmt.Errorf("Error: canary_weight must be between 0 and 100")
+	}
+
+	if vargs.CanaryIngress != "" && vargs.CanaryWeight == nil {
+		return fmt.Errorf("Missing required param: canary_weight (when canary_ingress is set)")
+	}
+
+	if vargs.ChangeSummary && vargs.PruneLabel == "" {
+		return fmt.Errorf("Missing required param: prune_label (when change_summary is set)")
+	}
+
+	// Forcing conflicts only applies to server-side applies.
+	if len(vargs.TakeOwnership) > 0 && !vargs.ServerSide {
+		return fmt.Errorf("Error: take_ownership requires server_side")
+	}
+
+	// Server-side applies don't report which objects are unchanged.
+	if vargs.FailIfUnchanged && vargs.ServerSide {
+		return fmt.Errorf("Error: fail_if_unchanged can't be used with server_side")
+	}
+
+	if vargs.SystemNamespace != "" && !vargs.DeployLock {
+		return fmt.Errorf("Error: system_namespace requires deploy_lock")
+	}
+
+	if vargs.SystemNamespace != "" {
+		if err := validateDNSLabel(vargs.SystemNamespace); err != nil {
+			return fmt.Errorf("Error: system_namespace %q is invalid: %s\n", vargs.SystemNamespace, err)
+		}
+	}
+
+	if vargs.PruneCascade != "" && !vargs.Prune {
+		return fmt.Errorf("Error: prune_cascade requires prune")
+	}
+
+	if vargs.PruneIfChanged && !vargs.Prune {
+		return fmt.Errorf("Error: prune_if_changed requires prune")
+	}
+
+	if vargs.PruneIfChanged && vargs.StateFile == "" {
+		return fmt.Errorf("Missing required param: state_file (when prune_if_changed is set)")
+	}
+
+	if vargs.ScaleNodePool != "" && vargs.NodePoolSize <= 0 {
+		return fmt.Errorf("Missing required param: node_pool_size (when scale_node_pool is set)")
+	}
+
+	sdkPath := "/google-cloud-sdk"
+	keyPath := "/tmp/gcloud.json"
+
+	// Defaults.
+
+	if vargs.GCloudCmd == "" {
+		vargs.GCloudCmd = fmt.Sprintf("%s/bin/gcloud", sdkPath)
+	}
+
+	if vargs.KubectlCmd == "" {
+		vargs.KubectlCmd = fmt.Sprintf("%s/bin/kubectl", sdkPath)
+	}
+
+	if vargs.HelmCmd == "" {
+		vargs.HelmCmd = "helm"
+	}
+
+	if vargs.HelmRelease == "" && vargs.HelmChart != "" {
+		vargs.HelmRelease = filepath.Base(vargs.HelmChart)
+	}
+
+	if vargs.Template == "" {
+		vargs.Template = ".kube.yml"
+	}
+
+	if vargs.SecretTemplate == "" {
+		vargs.SecretTemplate = ".kube.sec.yml"
+	}
+
+	if vargs.OutputDir == "" {
+		vargs.OutputDir = "/tmp"
+	}
+
+	if !filepath.IsAbs(vargs.OutputDir) {
+		vargs.OutputDir = filepath.Join(workspace.Path, vargs.OutputDir)
+	}
+
+	if vargs.OutputNameTemplate == "" {
+		vargs.OutputNameTemplate = defaultOutputNameTemplate
+	}
+
+	vargs.Template, err = resolveEnvironment(vargs.Template, vargs.Environment)
+	if err != nil {
+		return err
+	}
+
+	vargs.SecretTemplate, err = resolveEnvironment(vargs.SecretTemplate, vargs.Environment)
+	if err != nil {
+		return err
+	}
+
+	if vargs.TemplateOnly {
+		fmt.Println("Skipping secret template and secrets, because template_only: true")
+		vargs.SecretTemplate = ""
+		vargs.Secrets = nil
+		vargs.SecretsBase64 = nil
+		vargs.SecretKeyMap = nil
+		vargs.GSMSecrets = nil
+		vargs.SecretFiles = nil
+	}
+
+	// Without rendering, there's nowhere for the secrets to go.
+	if vargs.NoTemplate && (len(vargs.Secrets) > 0 || len(vargs.SecretsBase64) > 0 || len(vargs.GSMSecrets) > 0 || len(vargs.SecretFiles) > 0) {
+		fmt.Println("Ignoring secrets, because no_template: true")
+		vargs.Secrets = nil
+		vargs.SecretsBase64 = nil
+		vargs.SecretKeyMap = nil
+		vargs.GSMSecrets = nil
+		vargs.SecretFiles = nil
+	}
+
+	if vargs.SecretTemplate != "" && sameTemplate(vargs.Template, vargs.SecretTemplate) {
+		return fmt.Errorf("Error: template and secret_template are both %s, they must be separate files\n", vargs.Template)
+	}
+
+	for i, t := range vargs.ReplaceTemplates {
+		vargs.ReplaceTemplates[i], err = resolveEnvironment(t, vargs.Environment)
+		if err != nil {
+			return err
+		}
+
+		if vargs.ReplaceTemplates[i] != vargs.Template && vargs.ReplaceTemplates[i] != vargs.SecretTemplate {
+			return fmt.Errorf("Error: replace_templates entry %q is not the template or secret_template\n", t)
+		}
+	}
+
+	if vargs.MissingKey == "" {
+		vargs.MissingKey = "error"
+	}
+
+	if (vargs.LeftDelim == "") != (vargs.RightDelim == "") {
+		return fmt.Errorf("Error: left_delim and right_delim must be set together")
+	}
+
+	err = validateMissingKey(vargs.MissingKey, vargs.TemplateMissingKey)
+	if err != nil {
+		return err
+	}
+
+	err = validateSHA256(vargs.TemplateSHA256, vargs.Template, vargs.SecretTemplate)
+	if err != nil {
+		return err
+	}
+
+	if vargs.LBTimeout == "" {
+		vargs.LBTimeout = "5m"
+	}
+
+	if vargs.LBOutputFile == "" {
+		vargs.LBOutputFile = ".env"
+	}
+
+	if vargs.LBOutputKey == "" {
+		vargs.LBOutputKey = "LB_IP"
+	}
+
+	lbTimeout, err := time.ParseDuration(vargs.LBTimeout)
+	if err != nil {
+		return fmt.Errorf("Error: invalid lb_timeout %q: %s\n", vargs.LBTimeout, err)
+	}
+
+	if vargs.RolloutTimeout == "" {
+		vargs.RolloutTimeout = "5m"
+	}
+
+	if _, err := time.ParseDuration(vargs.RolloutTimeout); err != nil {
+		return fmt.Errorf("Error: invalid rollout_timeout %q: %s\n", vargs.RolloutTimeout, err)
+	}
+
+	for _, entry := range vargs.WaitCondition {
+		if _, _, err := parseWaitCondition(entry); err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if _, err := retryBackoff(vargs); err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	if vargs.WaitConditionTimeout == "" {
+		vargs.WaitConditionTimeout = "5m"
+	}
+
+	waitConditionTimeout, err := time.ParseDuration(vargs.WaitConditionTimeout)
+	if err != nil {
+		return fmt.Errorf("Error: invalid wait_condition_timeout %q: %s\n", vargs.WaitConditionTimeout, err)
+	}
+
+	if vargs.SmokeTestTimeout == "" {
+		vargs.SmokeTestTimeout = "5m"
+	}
+
+	if _, err := time.ParseDuration(vargs.SmokeTestTimeout); err != nil {
+		return fmt.Errorf("Error: invalid smoke_test_timeout %q: %s\n", vargs.SmokeTestTimeout, err)
+	}
+
+	if vargs.LockTimeout == "" {
+		vargs.LockTimeout = "30m"
+	}
+
+	lockTimeout, err := time.ParseDuration(vargs.LockTimeout)
+	if err != nil {
+		return fmt.Errorf("Error: invalid lock_timeout %q: %s\n", vargs.LockTimeout, err)
+	}
+
+	if vargs.PrintEffectiveConfig {
+		config, err := effectiveConfig(vargs, sources)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+		dumpText(os.Stdout, "EFFECTIVE CONFIG (Token and Secrets Redacted)", config)
+
+		if vargs.PrintEffectiveConfigOnly {
+			fmt.Println("Skipping the deploy, because print_effective_config_only: true")
+			return nil
+		}
+	}
+
+	// Trim whitespace, to forgive the vagaries of YAML parsing.
+	vargs.Token = strings.TrimSpace(vargs.Token)
+
+	// Without gcloud, only kubectl needs a token, the cluster's.
+	if vargs.SkipAuth {
+		keyPath = clusterTokenPath
+		vargs.ClusterToken = strings.TrimSpace(vargs.ClusterToken)
+	}
+
+	// Write credentials to tmp file to be picked up by the 'gcloud' command.
+	// This is inside the ephemeral plugin container, not on the host.
+	token := vargs.Token
+	if vargs.SkipAuth {
+		token = vargs.ClusterToken
+	}
+	err = ioutil.WriteFile(keyPath, []byte(token), 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing token file: %s\n", err)
+	}
+
+	// Warn if the keyfile can't be deleted, but don't abort.
+	// We're almost certainly running inside an ephemeral container, so the file will be discarded when we're finished anyway.
+	defer func() {
+		err := os.Remove(keyPath)
+		if err != nil {
+			fmt.Printf("Warning: error removing token file: %s\n", err)
+		}
+	}()
+
+	e := os.Environ()
+	if !vargs.SkipAuth {
+		e = append(e, fmt.Sprintf("GOOGLE_APPLICATION_CREDENTIALS=%s", keyPath))
+	}
+	if vargs.NoColor {
+		e = append(e, noColorEnv...)
+	}
+	e = append(e, proxyEnv(vargs)...)
+
+	// Keep gcloud's credentials and config out of the shared home directory on reused runners.
+	if vargs.GCloudConfigDir != "" {
+		configDir := filepath.Join(vargs.GCloudConfigDir, fmt.Sprintf("build-%d", build.Number))
+
+		err = os.MkdirAll(configDir, 0700)
+		if err != nil {
+			return fmt.Errorf("Error creating gcloud config directory: %s\n", err)
+		}
+
+		defer func() {
+			err := os.RemoveAll(configDir)
+			if err != nil {
+				fmt.Printf("Warning: error removing gcloud config directory: %s\n", err)
+			}
+		}()
+
+		e = append(e, fmt.Sprintf("CLOUDSDK_CONFIG=%s", configDir))
+	}
+	runner := NewEnviron(workspace.Path, e, os.Stdout, os.Stderr)
+	runner.printOnly = vargs.PrintCommands
+	runner.noColor = vargs.NoColor
+
+	if vargs.PrintCommands {
+		fmt.Println("Printing commands without running them, because print_commands: true")
+	}
+
+	if vargs.SkipAuth {
+		fmt.Println("Skipping gcloud authentication, because skip_auth: true")
+	} else if vargs.OfflineSchema != "" {
+		fmt.Println("Skipping gcloud authentication, because offline_schema is set")
+	} else {
+		stopAuth := res.startPhase("auth", "")
+		err = runner.Run(vargs.GCloudCmd, "auth", "activate-service-account", "--key-file", keyPath)
+		stopAuth()
+		res.record("auth", "", err)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if vargs.FromGCloudConfig {
+		config, err := readGCloudConfig(runner, vargs)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+
+		applyGCloudConfig(&vargs, config)
+
+		if err := checkLocation(vargs); err != nil {
+			return err
+		}
+	}
+
+	secretFiles, err := readSecretFiles(workspace.Path, vargs.SecretFiles)
+	if err != nil {
+		return fmt.Errorf("Error reading secret file: %s\n", err)
+	}
+
+	gsmSecrets, err := fetchGSMSecrets(runner, vargs)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the secret vars set by more than one source, in order of precedence.
+	merged, overrides, err := mergeSecrets([]secretSource{
+		{"secrets", vargs.Secrets},
+		{"secrets_base64", vargs.SecretsBase64},
+		{"secret_files", secretFiles},
+		{"gsm_secrets", gsmSecrets},
+	}, vargs.AllowSecretOverride)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	for _, o := range overrides {
+		fmt.Printf("Warning: %s\n", o)
+	}
+
+	vargs.Secrets, vargs.SecretsBase64 = merged[0], merged[1]
+	for _, m := range merged[2:] {
+		for k, v := range m {
+			vargs.Secrets[k] = v
+		}
+	}
+
+	if err := checkMaxSecrets(vargs.Secrets, vargs.SecretsBase64, vargs.MaxSecrets); err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	var offlineSchema *schemaValidator
+	if vargs.OfflineSchema != "" {
+		offlineSchema, err = readSchemaValidator(filepath.Join(workspace.Path, vargs.OfflineSchema))
+		if err != nil {
+			return fmt.Errorf("Error reading offline_schema: %s\n", err)
+		}
+	}
+
+	p := params{
+		workspace: workspace,
+		repo:      repo,
+		build:     build,
+		system:    system,
+
+		lbTimeout:   lbTimeout,
+		lockTimeout: lockTimeout,
+		imageDigest: imageDigest,
+
+		waitConditionTimeout: waitConditionTimeout,
+
+		fanoutNamespaces: fanout,
+		offlineSchema:    offlineSchema,
+
+		result: res,
+		index:  index,
+	}
+
+	if vargs.Parallel && len(clusters) > 1 {
+		return deployParallel(vargs, clusters, namespaces, runner, p, vargs.ParallelLimit)
+	}
+
+	for i, cluster := range clusters {
+		cv := vargs
+		cv.Cluster = cluster
+		cv.Namespace = namespaces[i]
+
+		if len(clusters) > 1 {
+			fmt.Printf("\nDeploying to cluster %s (%d of %d)\n", cluster, i+1, len(clusters))
+		}
+
+		// Give each cluster its own kubeconfig, so their contexts can't interfere.
+		clusterRunner := runner
+		if len(clusters) > 1 || vargs.UniqueContext {
+			kubeconfig := kubeconfigPath(i, cluster)
+			if vargs.UniqueContext {
+				kubeconfig = uniqueName(kubeconfig, build.Number)
+			}
+			clusterRunner = runner.WithEnv("KUBECONFIG=" + kubeconfig)
+			defer removeKubeconfig(kubeconfig)
+		}
+
+		err = deployFanout(cv, clusterRunner, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// params holds the Drone plugin params, besides the vargs.
+type params struct {
+	workspace plugin.Workspace
+	repo      plugin.Repo
+	build     plugin.Build
+	system    plugin.System
+
+	lbTimeout   time.Duration
+	lockTimeout time.Duration
+
+	// imageDigest is read from the image digest file.
+	imageDigest string
+
+	// waitConditionTimeout is shared by the wait_condition waits.
+	waitConditionTimeout time.Duration
+
+	// offlineSchema is read from the offline_schema file.
+	offlineSchema *schemaValidator
+
+	// fanoutNamespaces are deployed to in turn in each cluster.
+	fanoutNamespaces []string
+
+	// result records the exit codes of the commands for the result file.
+	result *result
+
+	// index records the manifests applied to each cluster for the manifest index.
+	index *manifestIndex
+}
+
+// deployCluster renders and applies the templates to a single cluster.
+func deployCluster(vargs GKE, runner *Environ, p params) error {
+	workspace, repo, build, system := p.workspace, p.repo, p.build, p.system
+
+	// With fanout_namespaces, the templates are rendered and validated once,
+	// with the namespace, then applied to each fanout namespace in turn.
+	namespaces := []string{vargs.Namespace}
+	if len(p.fanoutNamespaces) > 0 {
+		namespaces = p.fanoutNamespaces
+	}
+
+	stop := p.result.startPhase("get-credentials", vargs.Cluster)
+	defer stop()
+
+	var err error
+	if vargs.OfflineSchema != "" {
+		runner.Println("Skipping get-credentials, because offline_schema is set")
+	} else if vargs.SkipAuth {
+		runner.Printf("Configuring kubectl for %s\n", vargs.APIServer)
+
+		caFile := ""
+		if vargs.ClusterCAFile != "" {
+			caFile = filepath.Join(workspace.Path, vargs.ClusterCAFile)
+		}
+
+		for _, args := range kubeconfigArgs(vargs, caFile, clusterTokenPath) {
+			err = runner.Run(vargs.KubectlCmd, args...)
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		getCredentialsArgs := []string{"container", "clusters", "get-credentials", vargs.Cluster, "--project", vargs.Project}
+		err = runner.Run(vargs.GCloudCmd, append(getCredentialsArgs, locationArgs(vargs)...)...)
+	}
+	if vargs.OfflineSchema == "" {
+		p.result.record("get-credentials", vargs.Cluster, err)
+	}
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	// Use the context explicitly, rather than whatever the current context is.
+	if vargs.Context == "" {
+		vargs.Context = clusterContext(vargs)
+	}
+
+	if vargs.UniqueContext {
+		unique := uniqueName(vargs.Context, build.Number)
+		err = runner.Run(vargs.KubectlCmd, "config", "rename-context", vargs.Context, unique)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+		vargs.Context = unique
+	}
+
+	if vargs.ClusterCAFile != "" && !vargs.SkipAuth {
+		runner.Printf("Setting the cluster CA from %s\n", vargs.ClusterCAFile)
+
+		// get-credentials names the cluster entry like its context.
+		err = runner.Run(vargs.KubectlCmd, "config", "set-cluster", clusterContext(vargs),
+			"--certificate-authority", filepath.Join(workspace.Path, vargs.ClusterCAFile), "--embed-certs=true")
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	stop()
+	stop = p.result.startPhase("render", vargs.Cluster)
+	defer stop()
+
+	data := map[string]interface{}{
+		// http://readme.drone.io/usage/variables/#string-interpolation:2b8b8ac4006be88c769f5e3fd99b009a
+		"BUILD_NUMBER": build.Number,
+		"COMMIT":       build.Commit,
+		"COMMIT_SHORT": shortCommit(build.Commit),
+		"BRANCH":       build.Branch,
+		"STAGE_NAME":   vargs.StageName,
+		"STEP_NAME":    vargs.StepName,
+		"TAG":          "", // How?
+
+		// https://godoc.org/github.com/drone/drone-plugin-go/plugin#Workspace
+		"workspace": workspace,
+		"repo":      repo,
+		"build":     build,
+		"system":    system,
+
+		// Misc useful stuff.
+		// Note that we don't include all of the vargs, since that includes the GCP token.
+		"project":   vargs.Project,
+		"zone":      vargs.Zone,
+		"region":    vargs.Region,
+		"cluster":   vargs.Cluster,
+		"namespace": vargs.Namespace,
+
+		// The service account the deploy runs as.
+		"SA_EMAIL": getEmailFromToken(vargs.Token),
+
+		"CANARY_WEIGHT": canaryWeight(vargs),
+		"CHANGE_CAUSE":  changeCause(vargs, build),
+
+		// Org-wide resource defaults, for templates to fall back to.
+		"DEFAULT_CPU_REQUEST":    vargs.DefaultCPURequest,
+		"DEFAULT_MEMORY_REQUEST": vargs.DefaultMemoryRequest,
+		"DEFAULT_CPU_LIMIT":      vargs.DefaultCPULimit,
+		"DEFAULT_MEMORY_LIMIT":   vargs.DefaultMemoryLimit,
+		"DEFAULT_NODE_SELECTOR":  defaultNodeSelector(vargs),
+
+		// The names of the secrets (never their values), to reference them from the template.
+		"SECRET_NAMES": secretNames(vargs),
+	}
+
+	// Only set when configured, so they don't shadow existing vars.
+	if vargs.CreatePullSecret {
+		data["PULL_SECRET_NAME"] = vargs.PullSecretName
+	}
+
+	if p.imageDigest != "" {
+		data["IMAGE_DIGEST"] = p.imageDigest
+		if vargs.ImageRepo != "" {
+			data["IMAGE"] = vargs.ImageRepo + "@" + p.imageDigest
+		}
+	}
+
+	for k, v := range vargs.Vars {
+		// Don't allow vars to be overridden.
+		// We do this to ensure that the built-in template vars (above) can be relied upon.
+		if _, ok := data[k]; ok {
+			return fmt.Errorf("Error: var %q shadows existing var\n", k)
+		}
+
+		data[k] = v
+	}
+
+	nsLabels, err := renderValues(vargs.NamespaceLabels, vargs.LeftDelim, vargs.RightDelim, data)
+	if err != nil {
+		return err
+	}
+	for k, v := range nsLabels {
+		if err := validateLabelValue(v); err != nil {
+			return fmt.Errorf("Error: namespace label %q value %q is invalid: %s\n", k, v, err)
+		}
+	}
+
+	nsAnnotations, err := renderValues(vargs.NamespaceAnnotations, vargs.LeftDelim, vargs.RightDelim, data)
+	if err != nil {
+		return err
+	}
+
+	if vargs.Verbose {
+		dump := data
+		delete(dump, "workspace")
+		dumpData(runner.logOutput(), "DATA (Workspace Values Omitted)", dump)
+	}
+
+	secrets := map[string]interface{}{}
+	// sensitive holds every form of the secret values, to be redacted from captured output.
+	sensitive := []string{}
+	for k, v := range vargs.Secrets {
+		if v == "" {
+			return fmt.Errorf("Error: secret var %q is an empty string\n", k)
+		}
+
+		// Base64 encode secret strings.
+		secrets[k] = base64.StdEncoding.EncodeToString([]byte(v))
+		sensitive = append(sensitive, v, secrets[k].(string))
+	}
+	for k, v := range vargs.SecretsBase64 {
+		if _, ok := secrets[k]; ok {
+			return fmt.Errorf("Error: secret var %q is already set in Secrets\n", k)
+		}
+		if v == "" {
+			return fmt.Errorf("Error: secret var %q is an empty string\n", k)
+		}
+		// Don't base64 encode these secrets, they already are.
+		secrets[k] = v
+		sensitive = append(sensitive, v)
+		if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+			sensitive = append(sensitive, string(decoded))
+		}
+	}
+
+	// Alias secrets under their mapped keys, keeping the original keys available.
+	for k, alias := range vargs.SecretKeyMap {
+		v, ok := secrets[k]
+		if !ok {
+			return fmt.Errorf("Error: secret_key_map references unknown secret var %q\n", k)
+		}
+		if _, ok := secrets[alias]; ok {
+			return fmt.Errorf("Error: secret_key_map key %q shadows existing secret var\n", alias)
+		}
+		secrets[alias] = v
+	}
+
+	mapping := map[string]map[string]interface{}{
+		vargs.Template:       data,
+		vargs.SecretTemplate: secrets,
+	}
+
+	outPaths := make(map[string]string)
+	pathArg := []string{}
+
+	// secretTemplates are rendered with the secrets.
+	secretTemplates := map[string]bool{vargs.SecretTemplate: true}
+
+	if vargs.ManifestDir != "" {
+		manifestDir := filepath.Join(workspace.Path, vargs.ManifestDir)
+
+		// Ensure the manifest directory exists.
+		fi, err := os.Stat(manifestDir)
+		if err != nil {
+			return fmt.Errorf("Error finding manifest directory: %s\n", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("Error: manifest_dir %s is not a directory\n", vargs.ManifestDir)
+		}
+
+		runner.Printf("Skipping templates, applying manifest directory %s\n", vargs.ManifestDir)
+		mapping = nil
+		pathArg = append(pathArg, manifestDir)
+	}
+
+	err = os.MkdirAll(vargs.OutputDir, 0755)
+	if err != nil {
+		return fmt.Errorf("Error creating output directory: %s\n", err)
+	}
+
+	var generated []byte
+	if vargs.KustomizeDir != "" {
+		runner.Printf("Building kustomization %s\n", vargs.KustomizeDir)
+
+		out := &bytes.Buffer{}
+		err = runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, "kustomize", filepath.Join(workspace.Path, vargs.KustomizeDir))
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+		generated = out.Bytes()
+	}
+
+	if vargs.HelmChart != "" {
+		runner.Printf("Rendering Helm chart %s as %s\n", vargs.HelmChart, vargs.HelmRelease)
+
+		out := &bytes.Buffer{}
+		err = runner.WithOutput(out, runner.stderr).Run(vargs.HelmCmd, helmTemplateArgs(vargs)...)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+		generated = out.Bytes()
+	}
+
+	var header string
+	if vargs.ManifestHeader != "" {
+		headerData := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			headerData[k] = v
+		}
+		headerData["RENDER_TIME"] = time.Now().UTC().Format(time.RFC3339)
+
+		header, err = manifestHeader(vargs.ManifestHeader, vargs.LeftDelim, vargs.RightDelim, headerData)
+		if err != nil {
+			return err
+		}
+	}
+
+	for t, content := range mapping {
+		if t == "" {
+			continue
+		}
+
+		inPath := filepath.Join(workspace.Path, t)
+		bn := filepath.Base(inPath)
+
+		var blob []byte
+		if t == vargs.Template && (vargs.KustomizeDir != "" || vargs.HelmChart != "") {
+			// Render the kustomize or Helm output in place of the template.
+			blob = generated
+		} else if isRemote(t) {
+			blob, err = fetchTemplate(t, vargs.TemplateSHA256[t])
+			if err == errTemplateNotFound {
+				if t == vargs.Template {
+					return fmt.Errorf("Error finding template: %s was not found\n", t)
+				}
+				runner.Printf("Warning: skipping optional template %s, it was not found\n", t)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			// Ensure the required template file exists.
+			_, err := os.Stat(inPath)
+			if os.IsNotExist(err) {
+				if t == vargs.Template {
+					return fmt.Errorf("Error finding template: %s\n", err)
+				} else {
+					runner.Printf("Warning: skipping optional template %s, it was not found\n", t)
+					continue
+				}
+			}
+
+			// Generate the file.
+			blob, err = ioutil.ReadFile(inPath)
+			if err != nil {
+				return fmt.Errorf("Error reading template: %s\n", err)
+			}
+		}
+
+		missingKey := vargs.MissingKey
+		if mk, ok := vargs.TemplateMissingKey[t]; ok {
+			missingKey = mk
+		}
+
+		// Pre-rendered manifests, and Helm output, may be used as is, since they
+		// can contain template delimiters of their own.
+		skipRender := vargs.NoTemplate || (t == vargs.Template && vargs.HelmSkipRender)
+
+		// The template can ask for the secrets in its front-matter, instead of
+		// being the secret template.
+		if t == vargs.Template && !skipRender {
+			opts, err := parseFrontMatter(blob)
+			if err != nil {
+				return fmt.Errorf("Error parsing the front-matter of %s: %s\n", t, err)
+			}
+
+			if opts.Secrets {
+				content, err = secretsAndData(data, secrets)
+				if err != nil {
+					return fmt.Errorf("Error: %s\n", err)
+				}
+				secretTemplates[t] = true
+			}
+		}
+
+		var tmpl *template.Template
+		if !skipRender {
+			tmpl, err = template.New(bn).Delims(vargs.LeftDelim, vargs.RightDelim).Option("missingkey=" + missingKey).Parse(string(blob))
+			if err != nil {
+				return fmt.Errorf("Error parsing template: %s\n", err)
+			}
+		}
+
+		outName, err := outputName(vargs.OutputNameTemplate, vargs.LeftDelim, vargs.RightDelim, t, data)
+		if err != nil {
+			return err
+		}
+
+		outPath := filepath.Join(vargs.OutputDir, outName)
+		for other, p := range outPaths {
+			if p == outPath {
+				return fmt.Errorf("Error: templates %s and %s both render to %s\n", other, t, outPath)
+			}
+		}
+
+		outPaths[t] = outPath
+		f, err := os.Create(outPaths[t])
+		if err != nil {
+			return fmt.Errorf("Error creating deployment file: %s\n", err)
+		}
+
+		if !vargs.KeepRendered {
+			defer removeRendered(outPaths[t])
+		}
+
+		// Secrets don't get the header, in case it reveals anything about them.
+		if header != "" && !secretTemplates[t] {
+			_, err = f.WriteString(header)
+			if err != nil {
+				return fmt.Errorf("Error writing deployment file: %s\n", err)
+			}
+		}
+
+		if skipRender {
+			_, err = f.Write(blob)
+			if err != nil {
+				return fmt.Errorf("Error writing deployment file: %s\n", err)
+			}
+		} else {
+			err = tmpl.Execute(f, content)
+			if err != nil {
+				return fmt.Errorf("Error executing deployment template: %s\n", err)
+			}
+		}
+
+		f.Close()
+
+		pathArg = append(pathArg, outPaths[t])
+	}
+
+	stop()
+	stop = p.result.startPhase("validate", vargs.Cluster)
+	defer stop()
+
+	// Filter the rendered objects by kind, leaving out files with none left.
+	rendered := pathArg
+	filtered := map[string]bool{}
+	if len(vargs.Kinds) > 0 || len(vargs.ExcludeKinds) > 0 {
+		kinds, exclude := vargs.Kinds, false
+		if len(vargs.ExcludeKinds) > 0 {
+			kinds, exclude = vargs.ExcludeKinds, true
+		}
+
+		pathArg = []string{}
+		for _, p := range rendered {
+			n, err := filterKinds(p, kinds, exclude)
+			if err != nil {
+				return fmt.Errorf("Error filtering kinds: %s\n", err)
+			}
+
+			if n == 0 {
+				runner.Printf("Skipping %s, because it has no objects of the selected kinds\n", p)
+				filtered[p] = true
+				continue
+			}
+			pathArg = append(pathArg, p)
+		}
+
+		if len(pathArg) == 0 {
+			runner.Println("Skipping kubectl apply, because there are no objects of the selected kinds")
+			return nil
+		}
+	}
+
+	if len(vargs.InjectLabels) > 0 || len(vargs.InjectAnnotations) > 0 {
+		for _, p := range pathArg {
+			n, err := injectMetadata(p, vargs.InjectLabels, vargs.InjectAnnotations)
+			if err != nil {
+				return fmt.Errorf("Error injecting labels and annotations: %s\n", err)
+			}
+			runner.Printf("Injected labels and annotations into %d objects in %s\n", n, p)
+		}
+	}
+
+	// Catch objects the API would reject for being too large, and lint the
+	// images, before applying.
+	manifests, err := manifestFiles(vargs, pathArg)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	docs, err := readDocuments(manifests...)
+	if err != nil {
+		// Some options need the objects, but otherwise leave malformed manifests for kubectl to report.
+		if vargs.WaitAll || vargs.LintImages || vargs.VerifyImages || len(vargs.TakeOwnership) > 0 {
+			return fmt.Errorf("Error parsing manifests: %s\n", err)
+		}
+		runner.Printf("Warning: skipping the ConfigMap and Secret size check: %s\n", err)
+	}
+
+	oversized := oversizedData(docs)
+	for _, o := range oversized {
+		runner.Printf("Warning: %s\n", o)
+	}
+
+	if len(oversized) > 0 && vargs.Strict {
+		return fmt.Errorf("Error: %d objects are too large, because strict: true\n", len(oversized))
+	}
+
+	if vargs.LintImages {
+		problems := lintImages(docs)
+		for _, l := range problems {
+			runner.Printf("Warning: %s\n", l)
+		}
+
+		if len(problems) > 0 && vargs.Strict {
+			return fmt.Errorf("Error: %d image lint problems found, because strict: true\n", len(problems))
+		}
+	}
+
+	if vargs.VerifyImages {
+		runner.Println("Verifying that the images exist")
+
+		missing := verifyImages(runner, vargs, documentImages(docs))
+		if len(missing) > 0 {
+			err = fmt.Errorf("Error: %d images don't exist, or can't be read by the service account: %s\n", len(missing), strings.Join(missing, ", "))
+		}
+		p.result.record("verify-images", vargs.Cluster, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if vargs.SecretRenderOut != "" {
+		// The template too, if it asked for the secrets in its front-matter.
+		secretPaths := []string{}
+		for _, t := range []string{vargs.Template, vargs.SecretTemplate} {
+			if path, ok := outPaths[t]; ok && secretTemplates[t] && !filtered[path] {
+				secretPaths = append(secretPaths, path)
+			}
+		}
+
+		if len(secretPaths) > 0 {
+			runner.Printf("Warning: writing the generated templates with secrets to %s, which contains sensitive data\n", vargs.SecretRenderOut)
+
+			err = copyPrivate(filepath.Join(workspace.Path, vargs.SecretRenderOut), secretPaths...)
+			if err != nil {
+				return fmt.Errorf("Error writing secret render output: %s\n", err)
+			}
+		} else {
+			runner.Println("Skipping secret_render_out, because no secret template was generated")
+		}
+	}
+
+	if vargs.SchemaValidate {
+		validator := p.offlineSchema
+		if validator != nil {
+			runner.Printf("Validating manifests against the OpenAPI schema in %s\n", vargs.OfflineSchema)
+		} else {
+			runner.Println("Validating manifests against the cluster's OpenAPI schema")
+
+			validator, err = fetchSchemaValidator(runner, vargs)
+			p.result.record("validate", vargs.Cluster, err)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+		}
+
+		if validator != nil {
+			manifests, err := manifestFiles(vargs, pathArg)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+
+			violations, err := validateSchema(validator, manifests)
+			if err != nil {
+				return fmt.Errorf("Error parsing manifests: %s\n", err)
+			}
+
+			for _, v := range violations {
+				runner.Printf("Schema violation: %s\n", v)
+			}
+
+			if len(violations) > 0 {
+				return fmt.Errorf("Error: %d schema violations found\n", len(violations))
+			}
+		}
+	}
+
+	if vargs.Verbose && vargs.ManifestDir == "" {
+		if secretTemplates[vargs.Template] {
+			runner.Println("Skipping the generated template dump, because it has secrets")
+		} else {
+			dumpFile(runner.logOutput(), "DEPLOYMENT (Secret Template Omitted)", outPaths[vargs.Template])
+		}
+	}
+
+	if vargs.PolicyOutput != "" {
+		if secretTemplates[vargs.Template] {
+			return fmt.Errorf("Error: policy_output can't be used with a template with secrets\n")
+		}
+
+		manifests := []string{outPaths[vargs.Template]}
+		if vargs.ManifestDir != "" {
+			manifests, err = manifestFiles(vargs, pathArg)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+		}
+
+		docs, err := readDocuments(manifests...)
+		if err != nil {
+			return fmt.Errorf("Error parsing manifests: %s\n", err)
+		}
+
+		err = writePolicyInput(filepath.Join(workspace.Path, vargs.PolicyOutput), docs)
+		if err != nil {
+			return fmt.Errorf("Error writing policy output file: %s\n", err)
+		}
+
+		runner.Printf("Wrote policy input to %s\n", vargs.PolicyOutput)
+	}
+
+	// Check the changes in each namespace before applying to any.
+	summaries := make([]*changes, len(namespaces))
+	for i, ns := range namespaces {
+		vargs := vargs
+		vargs.Namespace = ns
+
+		if vargs.ManifestIndex != "" {
+			templates := map[string]string{}
+			for t, path := range outPaths {
+				templates[path] = t
+			}
+
+			err = p.index.add(vargs, workspace.Path, manifests, templates)
+			if err != nil {
+				return fmt.Errorf("Error indexing manifests: %s\n", err)
+			}
+		}
+
+		if vargs.DiffOutput != "" {
+			diffArgs := []string{"diff"}
+			if vargs.ManifestDir != "" {
+				diffArgs = append(diffArgs, "--recursive")
+			}
+			if vargs.Namespace != "" {
+				diffArgs = append(diffArgs, "--namespace", vargs.Namespace)
+			}
+			diffArgs = append(diffArgs, "--filename", strings.Join(pathArg, ","))
+
+			diff := &bytes.Buffer{}
+			err = runner.WithOutput(diff, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, diffArgs...)...)
+			p.result.record("diff", vargs.Cluster, err)
+			// kubectl diff exits with 1 when there are differences.
+			if status, ok := exitStatus(err); err != nil && !(ok && status == 1) {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+
+			if !vargs.PrintCommands {
+				diffPath := filepath.Join(workspace.Path, vargs.DiffOutput)
+				err = ioutil.WriteFile(diffPath, []byte(sanitize(diff.String(), sensitive)), 0644)
+				if err != nil {
+					return fmt.Errorf("Error writing diff output file: %s\n", err)
+				}
+
+				runner.Printf("Wrote diff output to %s\n", vargs.DiffOutput)
+			}
+		}
+
+		if vargs.Preview {
+			previewPath := outPaths[vargs.Template]
+			if vargs.ManifestDir != "" {
+				previewPath = pathArg[0]
+			}
+
+			if filtered[previewPath] {
+				runner.Println("Skipping preview, because the template has no objects of the selected kinds")
+			} else if secretTemplates[vargs.Template] {
+				runner.Println("Skipping preview, because the template has secrets")
+			} else {
+				diff, err := preview(runner, vargs, previewPath, vargs.ManifestDir != "")
+				p.result.record("preview", vargs.Cluster, err)
+				if err != nil {
+					return fmt.Errorf("Error: %s\n", err)
+				}
+
+				if !vargs.PrintCommands {
+					dumpText(runner.logOutput(), "PREVIEW (Secret Template Omitted)", diff)
+				}
+			}
+		}
+
+		// Summarize the changes now, before the apply changes the live objects,
+		// but print them at the end.
+		if vargs.ChangeSummary {
+			if len(docs) == 0 {
+				runner.Println("Skipping change_summary, because the manifests couldn't be parsed")
+			} else {
+				c, err := changedObjects(runner, vargs, docs, pathArg)
+				if err != nil {
+					return fmt.Errorf("Error: %s\n", err)
+				}
+				summaries[i] = &c
+			}
+		}
+	}
+
+	if vargs.DryRun {
+		if !vargs.PrintCommands {
+			printSummaries(runner, namespaces, summaries)
+		}
+		runner.Println("Skipping kubectl apply, because dry_run: true")
+		return nil
+	}
+
+	stop()
+	stop = p.result.startPhase("apply", vargs.Cluster)
+	defer stop()
+
+	// Scale up the node pool before applying, and optionally restore it afterwards.
+	if vargs.ScaleNodePool != "" {
+		runner.Printf("Resizing node pool %s to %d nodes\n", vargs.ScaleNodePool, vargs.NodePoolSize)
+
+		err = resizeNodePool(runner, vargs, vargs.NodePoolSize)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+
+		if vargs.NodePoolRestoreSize > 0 {
+			// Warn if the node pool can't be restored, but don't abort.
+			defer func() {
+				runner.Printf("Restoring node pool %s to %d nodes\n", vargs.ScaleNodePool, vargs.NodePoolRestoreSize)
+
+				err := resizeNodePool(runner, vargs, vargs.NodePoolRestoreSize)
+				if err != nil {
+					runner.Printf("Warning: error restoring node pool size: %s\n", err)
+				}
+			}()
+		}
+	}
+
+	for _, ns := range vargs.EnsureNamespaces {
+		runner.Printf("Ensuring the %s namespace exists\n", ns)
+
+		err = ensureNamespace(runner, vargs, ns, nsLabels, nsAnnotations)
+		if err != nil {
+			return err
+		}
+	}
+
+	m := renderedManifests{
+		outPaths: outPaths,
+		paths:    pathArg,
+		rendered: rendered,
+		filtered: filtered,
+		docs:     docs,
+
+		nsLabels:      nsLabels,
+		nsAnnotations: nsAnnotations,
+	}
+
+	for i, ns := range namespaces {
+		if len(namespaces) > 1 {
+			runner.Printf("\nApplying to namespace %s (%d of %d)\n", ns, i+1, len(namespaces))
+		}
+
+		// The first namespace's apply phase includes the node pool resize.
+		if i > 0 {
+			stop = p.result.startPhase("apply", vargs.Cluster)
+		}
+
+		nv := vargs
+		nv.Namespace = ns
+
+		err = applyNamespace(nv, runner, p, m, stop)
+		if err != nil {
+			return err
+		}
+	}
+
+	// With fanout_namespaces, the smoke test runs once, in the last
+	// namespace, which the context is left in.
+	vargs.Namespace = namespaces[len(namespaces)-1]
+
+	if vargs.SmokeTestTemplate != "" {
+		smokePath, name, err := renderSmokeTest(vargs, filepath.Join(workspace.Path, vargs.SmokeTestTemplate), data)
+		if err != nil {
+			return err
+		}
+
+		if !vargs.KeepRendered {
+			defer removeRendered(smokePath)
+		}
+
+		runner.Printf("Running smoke test Job %s\n", name)
+
+		err = runSmokeTest(runner, vargs, smokePath, name)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	for _, ns := range namespaces {
+		if vargs.AnnotateProvenance && ns != "" {
+			runner.Printf("Annotating the %s namespace with the build\n", ns)
+
+			err = annotateProvenance(runner, vargs, ns, build)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+		}
+	}
+
+	if !vargs.PrintCommands {
+		printSummaries(runner, namespaces, summaries)
+	}
+
+	return nil
+}
+
+// renderedManifests are a cluster's rendered and validated manifests, to
+// apply to each of its namespaces.
+type renderedManifests struct {
+	// outPaths are the rendered files by template, paths the files to apply,
+	// and rendered every rendered file, including those filtered out by kind.
+	outPaths map[string]string
+	paths    []string
+	rendered []string
+	filtered map[string]bool
+
+	// docs are the objects in the files to apply, if they could be parsed.
+	docs []document
+
+	nsLabels      map[string]string
+	nsAnnotations map[string]string
+}
+
+// applyNamespace applies the rendered manifests to vargs.Namespace, then
+// waits for them. stop ends the apply phase, which the caller started.
+func applyNamespace(vargs GKE, runner *Environ, p params, m renderedManifests, stop func()) error {
+	workspace, build := p.workspace, p.build
+	outPaths, pathArg, rendered, filtered, docs := m.outPaths, m.paths, m.rendered, m.filtered, m.docs
+	nsLabels, nsAnnotations := m.nsLabels, m.nsAnnotations
+
+	defer stop()
+
+	var err error
+
+	// Set the execution namespace.
+	if len(vargs.Namespace) > 0 {
+		if vargs.NamespaceMode != "inline" {
+			runner.Printf("Configuring kubectl to the %s namespace\n", vargs.Namespace)
+
+			err = runner.Run(vargs.KubectlCmd, "config", "set-context", vargs.Context, "--namespace", vargs.Namespace)
+			if err != nil {
+				return fmt.Errorf("Error: %s\n", err)
+			}
+		}
+
+		err = ensureNamespace(runner, vargs, vargs.Namespace, nsLabels, nsAnnotations)
+		if err != nil {
+			return err
+		}
+	}
+
+	if vargs.CreatePullSecret {
+		runner.Printf("Applying the image pull secret %s\n", vargs.PullSecretName)
+
+		err = applyPullSecret(runner, vargs)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if vargs.DeployLock {
+		runner.Println("Acquiring the deploy lock")
+
+		err = acquireLock(runner, vargs, build.Number, p.lockTimeout)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+		defer releaseLock(runner, vargs)
+	}
+
+	// Only prune when the manifests have changed since the last deploy.
+	var hash string
+	if vargs.PruneIfChanged {
+		manifests, err := manifestFiles(vargs, pathArg)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+
+		hash, err = manifestHash(manifests)
+		if err != nil {
+			return fmt.Errorf("Error hashing manifests: %s\n", err)
+		}
+
+		state, err := readState(filepath.Join(workspace.Path, vargs.StateFile))
+		if err != nil {
+			return fmt.Errorf("Error reading state file: %s\n", err)
+		}
+
+		if state[stateKey(vargs)] == hash {
+			runner.Println("Applying without pruning, because the manifests are unchanged since the last deploy")
+			vargs.Prune = false
+		}
+	}
+
+	// Replace templates are applied on their own, with kubectl replace.
+	replaced := map[string]bool{}
+	for _, t := range vargs.ReplaceTemplates {
+		if p, ok := outPaths[t]; ok && !filtered[p] {
+			replaced[p] = true
+		}
+	}
+
+	// Apply Kubernetes configuration files, all at once unless they're ordered.
+	applyGroups := [][]string{}
+	applyPaths := []string{}
+	for _, p := range pathArg {
+		if replaced[p] {
+			applyGroups = append(applyGroups, []string{p})
+		} else {
+			applyPaths = append(applyPaths, p)
+		}
+	}
+	if len(applyPaths) > 0 {
+		applyGroups = append(applyGroups, applyPaths)
+	}
+
+	if vargs.ApplyOrderFile != "" {
+		order, err := readApplyOrder(filepath.Join(workspace.Path, vargs.ApplyOrderFile))
+		if err != nil {
+			return fmt.Errorf("Error reading apply order file: %s\n", err)
+		}
+
+		ordered, err := orderPaths(order, outPaths, rendered, vargs.ApplyOrderStrict)
+		if err != nil {
+			return err
+		}
+
+		applyGroups = nil
+		for _, p := range ordered {
+			if filtered[p] {
+				continue
+			}
+			applyGroups = append(applyGroups, []string{p})
+		}
+	}
+
+	// Migrate the objects' fields from other field managers before applying.
+	if len(vargs.TakeOwnership) > 0 {
+		err = takeOwnership(runner, vargs, docs)
+		p.result.record("apply", vargs.Cluster, err)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	// Capture kubectl's output, to tell whether anything changed.
+	applied := &bytes.Buffer{}
+	applyRunner := runner.WithOutput(io.MultiWriter(runner.stdout, applied), runner.stderr)
+
+	err = applyInOrder(applyRunner, vargs, applyGroups, replaced, p.result)
+	if err != nil {
+		return err
+	}
+
+	if changed, ok := applyChanged(applied.String()); ok {
+		p.result.recordChanged(changed)
+
+		if !changed {
+			runner.Println("No objects changed")
+
+			if vargs.FailIfUnchanged {
+				return fmt.Errorf("Error: no objects changed, because fail_if_unchanged: true\n")
+			}
+		}
+	} else if vargs.FailIfUnchanged && !vargs.PrintCommands {
+		runner.Println("Warning: skipping fail_if_unchanged, because kubectl's output doesn't show what changed")
+	}
+
+	if vargs.PruneIfChanged && !vargs.PrintCommands {
+		err = writeState(filepath.Join(workspace.Path, vargs.StateFile), stateKey(vargs), hash)
+		if err != nil {
+			return fmt.Errorf("Error writing state file: %s\n", err)
+		}
+	}
+
+	stop()
+	stop = p.result.startPhase("wait", vargs.Cluster)
+	defer stop()
+
+	if vargs.WaitAll {
+		runner.Println("Waiting for the rollouts of the Deployments, StatefulSets and DaemonSets to finish")
+
+		err = waitRollouts(runner, vargs, docs)
+		p.result.record("wait", vargs.Cluster, err)
+		if err != nil {
+			if vargs.WatchEvents {
+				printWarningEvents(runner, vargs)
+			}
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if len(vargs.WaitCondition) > 0 {
+		err = waitConditions(runner, vargs, p.waitConditionTimeout)
+		p.result.record("wait", vargs.Cluster, err)
+		if err != nil {
+			if vargs.WatchEvents {
+				printWarningEvents(runner, vargs)
+			}
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if vargs.WatchEvents {
+		printWarningEvents(runner, vargs)
+	}
+
+	if vargs.CanaryIngress != "" {
+		runner.Printf("Setting canary weight of %s to %d\n", vargs.CanaryIngress, *vargs.CanaryWeight)
+
+		err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "annotate", "ingress", vargs.CanaryIngress, "--overwrite",
+			"nginx.ingress.kubernetes.io/canary=true",
+			fmt.Sprintf("nginx.ingress.kubernetes.io/canary-weight=%d", *vargs.CanaryWeight),
+		)...)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	if vargs.WaitLBService != "" {
+		runner.Printf("Waiting for a load balancer IP for %s\n", vargs.WaitLBService)
+
+		ip, err := waitLoadBalancerIP(runner, vargs, vargs.WaitLBService, p.lbTimeout)
+		p.result.record("wait", vargs.Cluster, err)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+
+		if !vargs.PrintCommands {
+			runner.Printf("Load balancer IP for %s is %s\n", vargs.WaitLBService, ip)
+
+			err = writeEnvOutput(filepath.Join(workspace.Path, vargs.LBOutputFile), vargs.LBOutputKey, ip)
+			if err != nil {
+				return fmt.Errorf("Error writing load balancer IP: %s\n", err)
+			}
+		}
+	}
+
+	stop()
+
+	if vargs.VerifyDeployedImage != "" {
+		runner.Printf("Verifying that %s uses %s\n", vargs.VerifyDeployment, vargs.VerifyDeployedImage)
+
+		err = verifyDeployedImage(runner, vargs)
+		if err != nil {
+			return fmt.Errorf("Error: %s\n", err)
+		}
+	}
+
+	return nil
+}
+
+// printSummaries prints the change summary of each namespace, by namespace
+// if there are several.
+func printSummaries(runner *Environ, namespaces []string, summaries []*changes) {
+	for i, c := range summaries {
+		if c == nil {
+			continue
+		}
+
+		if len(namespaces) > 1 {
+			runner.Printf("\nNamespace %s:\n", namespaces[i])
+		}
+		printChanges(runner, *c)
+	}
+}
+
+// secretNames returns the sorted keys the secrets are available under in the secret template.
+func secretNames(vargs GKE) []string {
+	names := []string{}
+	for k := range vargs.Secrets {
+		names = append(names, k)
+	}
+	for k := range vargs.SecretsBase64 {
+		names = append(names, k)
+	}
+	for _, alias := range vargs.SecretKeyMap {
+		names = append(names, alias)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// removeRendered removes a rendered file, which may contain secrets.
+// Warn if it can't be deleted, but don't abort.
+func removeRendered(path string) {
+	err := os.Remove(path)
+	if err != nil {
+		fmt.Printf("Warning: error removing rendered file: %s\n", err)
+	}
+}
+
+// copyPrivate copies the files to path, readable only by its owner, joined
+// as YAML documents.
+func copyPrivate(path string, srcs ...string) error {
+	blob := []byte{}
+	for i, src := range srcs {
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if len(blob) > 0 && blob[len(blob)-1] != '\n' {
+				blob = append(blob, '\n')
+			}
+			blob = append(blob, "---\n"...)
+		}
+		blob = append(blob, b...)
+	}
+
+	err := ioutil.WriteFile(path, blob, 0600)
+	if err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of an existing file.
+	return os.Chmod(path, 0600)
+}
+
+// checkLocation checks the required project and cluster location params.
+func checkLocation(vargs GKE) error {
+	if vargs.Project == "" {
+		return fmt.Errorf("Missing required param: project")
+	}
+
+	if vargs.Zone == "" && vargs.Region == "" {
+		return fmt.Errorf("Missing required param: zone or region")
+	}
+
+	if vargs.Zone != "" && vargs.Region != "" {
+		return fmt.Errorf("Error: only one of zone and region may be set")
+	}
+
+	return nil
+}
+
+// resizeNodePool resizes the configured node pool to the given number of nodes.
+func resizeNodePool(runner *Environ, vargs GKE, size int) error {
+	args := []string{"container", "clusters", "resize", vargs.Cluster,
+		"--node-pool", vargs.ScaleNodePool,
+		"--num-nodes", strconv.Itoa(size),
+		"--project", vargs.Project,
+		"--quiet",
+	}
+	return runner.Run(vargs.GCloudCmd, append(args, locationArgs(vargs)...)...)
+}
+
+// validateMissingKey checks the missingkey and template_missingkey values.
+func validateMissingKey(missingKey string, overrides map[string]string) error {
+	valid := map[string]bool{"error": true, "zero": true, "default": true}
+
+	if !valid[missingKey] {
+		return fmt.Errorf("Error: missingkey must be error, zero or default, not %q", missingKey)
+	}
+
+	for t, mk := range overrides {
+		if !valid[mk] {
+			return fmt.Errorf("Error: template_missingkey for %s must be error, zero or default, not %q", t, mk)
+		}
+	}
+
+	return nil
+}
+
+// locationArgs returns the gcloud arguments for the location of a zonal or regional cluster.
+func locationArgs(vargs GKE) []string {
+	if vargs.Region != "" {
+		return []string{"--region", vargs.Region}
+	}
+	return []string{"--zone", vargs.Zone}
+}
+
+// clusterContext returns the name of the kubectl context that gcloud
+// get-credentials creates for the cluster.
+func clusterContext(vargs GKE) string {
+	// With skip_auth, the context is named after the cluster.
+	if vargs.SkipAuth {
+		return vargs.Cluster
+	}
+
+	location := vargs.Zone
+	if vargs.Region != "" {
+		location = vargs.Region
+	}
+	return strings.Join([]string{"gke", vargs.Project, location, vargs.Cluster}, "_")
+}
+
+// envPlaceholder is replaced by the environment in template paths.
+const envPlaceholder = "{{env}}"
+
+// sameTemplate reports whether two template paths name the same file, like
+// ./a.yml and a.yml. URLs are compared as is.
+func sameTemplate(a, b string) bool {
+	if isRemote(a) || isRemote(b) {
+		return a == b
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// resolveEnvironment replaces the environment placeholder in a template path.
+func resolveEnvironment(path, env string) (string, error) {
+	if !strings.Contains(path, envPlaceholder) {
+		return path, nil
+	}
+
+	if env == "" {
+		return "", fmt.Errorf("Missing required param: environment (when %s contains %s)", path, envPlaceholder)
+	}
+
+	return strings.Replace(path, envPlaceholder, env, -1), nil
+}
+
+// isTruthy reports whether a var is true. False, zero, empty and null values
+// are false, as are strings like "false" and "0" (so vars set from strings
+// behave as expected).
+func isTruthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b
+		}
+		return strings.TrimSpace(v) != ""
+	default:
+		return true
+	}
+}
+
+// canaryWeight returns the canary weight, or 0 if it isn't set.
+func canaryWeight(vargs GKE) int {
+	if vargs.CanaryWeight == nil {
+		return 0
+	}
+	return *vargs.CanaryWeight
+}
+
+// changeCause returns the change cause for rollout history, defaulting to
+// the build number and commit.
+func changeCause(vargs GKE, build plugin.Build) string {
+	if vargs.ChangeCause != "" {
+		return vargs.ChangeCause
+	}
+	return fmt.Sprintf("drone build %d commit %s", build.Number, shortCommit(build.Commit))
+}
+
+// proxyEnv returns the proxy environment variables to set, in both cases,
+// since tools differ in which they read.
+func proxyEnv(vargs GKE) []string {
+	env := []string{}
+	for _, v := range []struct{ name, value string }{
+		{"HTTPS_PROXY", vargs.HTTPSProxy},
+		{"HTTP_PROXY", vargs.HTTPProxy},
+		{"NO_PROXY", vargs.NoProxy},
+	} {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value, strings.ToLower(v.name)+"="+v.value)
+		}
+	}
+	return env
+}
+
+// defaultNodeSelector returns the default node selector, which is empty
+// rather than nil when not set, so templates can always range over it.
+func defaultNodeSelector(vargs GKE) map[string]string {
+	if vargs.DefaultNodeSelector == nil {
+		return map[string]string{}
+	}
+	return vargs.DefaultNodeSelector
+}
+
+// shortCommit returns the conventional 7 character short form of a commit SHA.
+func shortCommit(commit string) string {
+	if len(commit) <= 7 {
+		return commit
+	}
+	return commit[:7]
+}
+
+// token holds the fields of the service account key that are safe to use,
+// never the private key.
+type token struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+}
+
+func getProjectFromToken(j string) string {
+	t := token{}
+	err := json.Unmarshal([]byte(j), &t)
+	if err != nil {
+		return ""
 	}
 	return t.ProjectID
 }
+
+// getEmailFromToken returns the service account's email, or "" if the token
+// can't be parsed.
+func getEmailFromToken(j string) string {
+	t := token{}
+	err := json.Unmarshal([]byte(j), &t)
+	if err != nil {
+		return ""
+	}
+	return t.ClientEmail
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortCommit(t *testing.T) {
+	assert.Equal(t, "", shortCommit(""))
+	assert.Equal(t, "abc", shortCommit("abc"))
+	assert.Equal(t, "abcdef1", shortCommit("abcdef1"))
+	assert.Equal(t, "e3b0c44", shortCommit("e3b0c44298fc1c149afbf4c8996fb92427ae41e4"))
+}
+
+func TestChangeCause(t *testing.T) {
+	build := plugin.Build{Number: 42, Commit: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4"}
+
+	assert.Equal(t, "drone build 42 commit e3b0c44", changeCause(GKE{}, build))
+	assert.Equal(t, "hotfix for #123", changeCause(GKE{ChangeCause: "hotfix for #123"}, build))
+}
+
+func TestGetEmailFromToken(t *testing.T) {
+	assert.Equal(t, "deploy@p.iam.gserviceaccount.com", getEmailFromToken(`{"project_id": "p", "client_email": "deploy@p.iam.gserviceaccount.com", "private_key": "key"}`))
+	assert.Equal(t, "", getEmailFromToken("not json"))
+}
+
+func TestProxyEnv(t *testing.T) {
+	assert.Equal(t, []string{}, proxyEnv(GKE{}))
+	assert.Equal(t, []string{
+		"HTTPS_PROXY=http://proxy:3128",
+		"https_proxy=http://proxy:3128",
+		"NO_PROXY=metadata.google.internal,169.254.169.254",
+		"no_proxy=metadata.google.internal,169.254.169.254",
+	}, proxyEnv(GKE{HTTPSProxy: "http://proxy:3128", NoProxy: "metadata.google.internal,169.254.169.254"}))
+}
+
+func TestDefaultNodeSelector(t *testing.T) {
+	assert.Equal(t, map[string]string{}, defaultNodeSelector(GKE{}))
+	assert.Equal(t, map[string]string{"pool": "dedicated"}, defaultNodeSelector(GKE{DefaultNodeSelector: map[string]string{"pool": "dedicated"}}))
+}
+
+func TestSecretNames(t *testing.T) {
+	assert.Equal(t, []string{}, secretNames(GKE{}))
+
+	vargs := GKE{
+		Secrets:       map[string]string{"b": "1", "a": "2"},
+		SecretsBase64: map[string]string{"c": "Mw=="},
+		SecretKeyMap:  map[string]string{"a": "a-alias"},
+	}
+	assert.Equal(t, []string{"a", "a-alias", "b", "c"}, secretNames(vargs))
+}
+
+func TestSameTemplate(t *testing.T) {
+	assert.True(t, sameTemplate(".kube.yml", ".kube.yml"))
+	assert.True(t, sameTemplate("./a.yml", "a.yml"))
+	assert.True(t, sameTemplate("k8s/../a.yml", "a.yml"))
+	assert.False(t, sameTemplate(".kube.yml", ".kube.sec.yml"))
+	assert.False(t, sameTemplate("k8s/a.yml", "a.yml"))
+
+	assert.True(t, sameTemplate("https://example.com/a.yml", "https://example.com/a.yml"))
+	assert.False(t, sameTemplate("https://example.com/a.yml", "https://example.com//a.yml"))
+}
+
+func TestResolveEnvironment(t *testing.T) {
+	path, err := resolveEnvironment(".kube.yml", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ".kube.yml", path)
+	}
+
+	path, err = resolveEnvironment("k8s/deployment.{{env}}.yml", "prod")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "k8s/deployment.prod.yml", path)
+	}
+
+	_, err = resolveEnvironment("k8s/deployment.{{env}}.yml", "")
+	assert.Error(t, err)
+}
+
+func TestIsTruthy(t *testing.T) {
+	for _, v := range []interface{}{true, float64(1), int64(1), "true", "1", "yes", []interface{}{}} {
+		assert.True(t, isTruthy(v), "%#v", v)
+	}
+
+	for _, v := range []interface{}{nil, false, float64(0), int64(0), 0, "", " ", "false", "False", "0"} {
+		assert.False(t, isTruthy(v), "%#v", v)
+	}
+}
+
+func TestClusterContext(t *testing.T) {
+	assert.Equal(t, "gke_my-project_us-east1-b_my-cluster", clusterContext(GKE{
+		Project: "my-project",
+		Zone:    "us-east1-b",
+		Cluster: "my-cluster",
+	}))
+	assert.Equal(t, "gke_my-project_us-east1_my-cluster", clusterContext(GKE{
+		Project: "my-project",
+		Region:  "us-east1",
+		Cluster: "my-cluster",
+	}))
+}
+
+func TestValidateMissingKey(t *testing.T) {
+	assert.NoError(t, validateMissingKey("error", nil))
+	assert.NoError(t, validateMissingKey("zero", map[string]string{".kube.sec.yml": "default"}))
+	assert.Error(t, validateMissingKey("invalid", nil))
+	assert.Error(t, validateMissingKey("error", map[string]string{".kube.sec.yml": "ignore"}))
+}
+
+func TestCopyPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "private")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, ".kube.sec.yml")
+	ioutil.WriteFile(src, []byte("kind: Secret\n"), 0644)
+
+	path := filepath.Join(dir, "secrets.yml")
+	ioutil.WriteFile(path, []byte("old"), 0644)
+
+	if assert.NoError(t, copyPrivate(path, src)) {
+		blob, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "kind: Secret\n", string(blob))
+
+		fi, _ := os.Stat(path)
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	// A template with secrets in its front-matter is joined with the secret template.
+	tmpl := filepath.Join(dir, ".kube.yml")
+	ioutil.WriteFile(tmpl, []byte("# drone-gke: secrets=true\nkind: Deployment"), 0644)
+
+	if assert.NoError(t, copyPrivate(path, tmpl, src)) {
+		blob, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "# drone-gke: secrets=true\nkind: Deployment\n---\nkind: Secret\n", string(blob))
+	}
+}
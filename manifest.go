@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// documentSeparator matches the YAML document separator lines in a manifest.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// document is a single object from a rendered manifest.
+type document struct {
+	Raw       string
+	Kind      string
+	Name      string
+	Namespace string
+
+	// Object holds the decoded document, with JSON compatible maps.
+	Object map[string]interface{}
+}
+
+// parseDocuments splits a YAML manifest into its documents, skipping empty ones.
+func parseDocuments(blob []byte) ([]document, error) {
+	docs := []document{}
+
+	for i, raw := range documentSeparator.Split(string(blob), -1) {
+		var v interface{}
+		err := yaml.Unmarshal([]byte(raw), &v)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %s", i+1, err)
+		}
+
+		if v == nil {
+			continue
+		}
+
+		obj, ok := normalizeYAML(v).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("document %d: not an object", i+1)
+		}
+
+		doc := document{
+			Raw:    strings.TrimSpace(raw) + "\n",
+			Object: obj,
+		}
+		doc.Kind, _ = obj["kind"].(string)
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			doc.Name, _ = metadata["name"].(string)
+			doc.Namespace, _ = metadata["namespace"].(string)
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// readDocuments parses the documents of each of the manifest files.
+func readDocuments(paths ...string) ([]document, error) {
+	docs := []document{}
+
+	for _, path := range paths {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := parseDocuments(blob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+
+		docs = append(docs, d...)
+	}
+
+	return docs, nil
+}
+
+// findDocument returns the document with the given kind and name.
+func findDocument(docs []document, kind, name string) (document, bool) {
+	for _, d := range docs {
+		if d.Kind == kind && d.Name == name {
+			return d, true
+		}
+	}
+
+	return document{}, false
+}
+
+// listManifests returns the manifest files kubectl would apply recursively from dir.
+func listManifests(dir string) ([]string, error) {
+	paths := []string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+
+		return nil
+	})
+
+	return paths, err
+}
+
+// writePolicyInput writes the objects, excluding Secrets, as a JSON array for policy checks.
+func writePolicyInput(path string, docs []document) error {
+	objs := []map[string]interface{}{}
+	for _, d := range docs {
+		if d.Kind == "Secret" {
+			continue
+		}
+		objs = append(objs, d.Object)
+	}
+
+	blob, err := json.MarshalIndent(objs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
+
+// manifestFiles returns the manifest files in paths, listing the files in the
+// manifest directory if it's being applied.
+func manifestFiles(vargs GKE, paths []string) ([]string, error) {
+	if vargs.ManifestDir == "" {
+		return paths, nil
+	}
+
+	files, err := listManifests(paths[0])
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest directory: %s", err)
+	}
+
+	return files, nil
+}
+
+// filterKinds rewrites the manifest file with only the documents whose kind
+// is in kinds, or, if exclude is set, isn't. It returns the number of
+// documents kept.
+func filterKinds(path string, kinds []string, exclude bool) (int, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	docs, err := parseDocuments(blob)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", path, err)
+	}
+
+	kept := []string{}
+	for _, d := range docs {
+		listed := false
+		for _, k := range kinds {
+			if strings.EqualFold(d.Kind, k) {
+				listed = true
+			}
+		}
+
+		if listed != exclude {
+			kept = append(kept, d.Raw)
+		}
+	}
+
+	err = ioutil.WriteFile(path, []byte(strings.Join(kept, "---\n")), 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(kept), nil
+}
+
+// injectMetadata rewrites the manifest file with the labels and annotations
+// merged into the metadata of each document (and of each item of a List),
+// overriding any already set. Documents without metadata are left as they
+// are. It returns the number of objects changed.
+func injectMetadata(path string, labels, annotations map[string]string) (int, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	docs, err := parseDocuments(blob)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", path, err)
+	}
+
+	changed := 0
+	out := []string{}
+	for _, d := range docs {
+		objects := []interface{}{d.Object}
+		if d.Kind == "List" {
+			objects, _ = d.Object["items"].([]interface{})
+		}
+
+		n := 0
+		for _, o := range objects {
+			obj, _ := o.(map[string]interface{})
+			if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+				mergeMetadata(metadata, "labels", labels)
+				mergeMetadata(metadata, "annotations", annotations)
+				n++
+			}
+		}
+
+		if n == 0 {
+			out = append(out, d.Raw)
+			continue
+		}
+		changed += n
+
+		b, err := yaml.Marshal(d.Object)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", path, err)
+		}
+
+		// Keep any comments (e.g. the manifest header) before the object.
+		out = append(out, leadingComments(d.Raw)+string(b))
+	}
+
+	err = ioutil.WriteFile(path, []byte(strings.Join(out, "---\n")), 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// mergeMetadata sets the values in the metadata's labels or annotations map.
+func mergeMetadata(metadata map[string]interface{}, field string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	m, ok := metadata[field].(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		metadata[field] = m
+	}
+
+	for k, v := range values {
+		m[k] = v
+	}
+}
+
+// leadingComments returns the comment lines at the start of a document.
+func leadingComments(raw string) string {
+	comments := ""
+	for _, line := range strings.SplitAfter(raw, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+		comments += line
+	}
+	return comments
+}
+
+// maxDataSize is the most data a ConfigMap or Secret can hold.
+const maxDataSize = 1 << 20
+
+// dataSize returns the size of a ConfigMap's or Secret's data, as written.
+func dataSize(doc document) int {
+	size := 0
+	for _, field := range []string{"data", "binaryData", "stringData"} {
+		m, _ := doc.Object[field].(map[string]interface{})
+		for k, v := range m {
+			size += len(k) + len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
+
+// oversizedData returns the ConfigMaps and Secrets in the documents whose data
+// exceeds the API's 1MiB limit.
+func oversizedData(docs []document) []string {
+	oversized := []string{}
+	for _, d := range docs {
+		if d.Kind != "ConfigMap" && d.Kind != "Secret" {
+			continue
+		}
+
+		if size := dataSize(d); size > maxDataSize {
+			oversized = append(oversized, fmt.Sprintf("%s/%s has %d bytes of data, over the 1MiB limit", d.Kind, d.Name, size))
+		}
+	}
+	return oversized
+}
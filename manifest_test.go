@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocuments(t *testing.T) {
+	docs, err := parseDocuments([]byte(`
+---
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: web
+  namespace: prod
+---
+# Just a comment.
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: web
+`))
+	if !assert.NoError(t, err) || !assert.Len(t, docs, 2) {
+		return
+	}
+
+	assert.Equal(t, "Deployment", docs[0].Kind)
+	assert.Equal(t, "web", docs[0].Name)
+	assert.Equal(t, "prod", docs[0].Namespace)
+	assert.Equal(t, "kind: Deployment\napiVersion: apps/v1\nmetadata:\n  name: web\n  namespace: prod\n", docs[0].Raw)
+	assert.Equal(t, "Service", docs[1].Kind)
+	assert.Equal(t, "", docs[1].Namespace)
+
+	d, ok := findDocument(docs, "Service", "web")
+	assert.True(t, ok)
+	assert.Equal(t, "v1", d.Object["apiVersion"])
+
+	_, ok = findDocument(docs, "Service", "api")
+	assert.False(t, ok)
+
+	_, err = parseDocuments([]byte("- just\n- a list\n"))
+	assert.Error(t, err)
+}
+
+func TestWritePolicyInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	docs, err := parseDocuments([]byte(`
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: config
+data:
+  replicas: "3"
+---
+kind: Secret
+apiVersion: v1
+metadata:
+  name: secret
+data:
+  password: c2VjcmV0
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	path := filepath.Join(dir, "policy.json")
+	if !assert.NoError(t, writePolicyInput(path, docs)) {
+		return
+	}
+
+	blob, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `[{"kind": "ConfigMap", "apiVersion": "v1", "metadata": {"name": "config"}, "data": {"replicas": "3"}}]`, string(blob))
+	}
+}
+
+func TestFilterKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinds")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := []byte(`kind: ConfigMap
+metadata:
+  name: config
+---
+kind: Deployment
+metadata:
+  name: app
+---
+kind: Service
+metadata:
+  name: app
+`)
+
+	path := filepath.Join(dir, "kube.yml")
+	ioutil.WriteFile(path, manifest, 0600)
+
+	n, err := filterKinds(path, []string{"configmap", "Service"}, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, n)
+		blob, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "kind: ConfigMap\nmetadata:\n  name: config\n---\nkind: Service\nmetadata:\n  name: app\n", string(blob))
+	}
+
+	ioutil.WriteFile(path, manifest, 0600)
+
+	n, err = filterKinds(path, []string{"ConfigMap", "Service"}, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, n)
+		blob, _ := ioutil.ReadFile(path)
+		assert.Equal(t, "kind: Deployment\nmetadata:\n  name: app\n", string(blob))
+	}
+
+	n, err = filterKinds(path, []string{"Secret"}, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, n)
+	}
+}
+
+func TestInjectMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inject")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.yml")
+	err = ioutil.WriteFile(path, []byte(`# Generated by drone-gke
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    team: old
+spec:
+  replicas: 2
+---
+kind: List
+items:
+- kind: ConfigMap
+  metadata:
+    name: config
+- kind: Unknown
+---
+# not an object with metadata
+kind: Thing
+`), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	n, err := injectMetadata(path, map[string]string{"team": "platform"}, map[string]string{"example.com/owner": "ops"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, n)
+
+	blob, _ := ioutil.ReadFile(path)
+	assert.True(t, strings.HasPrefix(string(blob), "# Generated by drone-gke\n"))
+
+	docs, err := parseDocuments(blob)
+	if !assert.NoError(t, err) || !assert.Len(t, docs, 3) {
+		return
+	}
+
+	metadata := docs[0].Object["metadata"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"app": "web", "team": "platform"}, metadata["labels"])
+	assert.Equal(t, map[string]interface{}{"example.com/owner": "ops"}, metadata["annotations"])
+	assert.Equal(t, map[string]interface{}{"replicas": 2}, docs[0].Object["spec"])
+
+	item := docs[1].Object["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"team": "platform"}, item["metadata"].(map[string]interface{})["labels"])
+
+	assert.Equal(t, "# not an object with metadata\nkind: Thing\n", docs[2].Raw)
+}
+
+func TestOversizedData(t *testing.T) {
+	big := strings.Repeat("a", maxDataSize)
+
+	docs, err := parseDocuments([]byte(`
+kind: ConfigMap
+metadata:
+  name: small
+data:
+  config: small
+---
+kind: ConfigMap
+metadata:
+  name: big
+data:
+  config: ` + big + `
+---
+kind: Secret
+metadata:
+  name: big
+stringData:
+  key: ` + big[:maxDataSize/2] + `
+data:
+  other: ` + big[:maxDataSize/2] + `
+---
+kind: Deployment
+metadata:
+  name: big
+spec:
+  config: ` + big + `
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		"ConfigMap/big has 1048582 bytes of data, over the 1MiB limit",
+		"Secret/big has 1048584 bytes of data, over the 1MiB limit",
+	}, oversizedData(docs))
+}
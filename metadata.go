@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dnsSubdomainRegexp matches a valid DNS-1123 subdomain, as required for
+// label and annotation key prefixes.
+var dnsSubdomainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+const dnsSubdomainMaxLength = 253
+
+// keyNameRegexp matches the name part of a label or annotation key.
+var keyNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+const keyNameMaxLength = 63
+
+// keyValues is a map of labels or annotations, set either as a map or as a
+// string of comma separated key=value pairs.
+type keyValues map[string]string
+
+// UnmarshalJSON decodes a map, or a string of key=value pairs.
+func (kv *keyValues) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		m, err := parseKeyValues(s)
+		if err != nil {
+			return err
+		}
+		*kv = m
+		return nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*kv = m
+	return nil
+}
+
+// parseKeyValues parses comma separated key=value pairs, like `app=web, tier=frontend`.
+func parseKeyValues(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q must be like key=value", strings.TrimSpace(pair))
+		}
+
+		k, v := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if _, ok := m[k]; ok {
+			return nil, fmt.Errorf("duplicate key %q", k)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// validateKey returns an error if k is not a valid label or annotation key:
+// a name, optionally with a DNS subdomain prefix, like `example.com/name`.
+func validateKey(k string) error {
+	name := k
+	if i := strings.Index(k, "/"); i >= 0 {
+		prefix := k[:i]
+		name = k[i+1:]
+
+		if len(prefix) > dnsSubdomainMaxLength {
+			return fmt.Errorf("prefix must be no more than %d characters", dnsSubdomainMaxLength)
+		}
+		if !dnsSubdomainRegexp.MatchString(prefix) {
+			return fmt.Errorf("prefix must be a DNS subdomain: lower case alphanumeric characters, '-' or '.', starting and ending with an alphanumeric character")
+		}
+	}
+
+	if name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if len(name) > keyNameMaxLength {
+		return fmt.Errorf("name must be no more than %d characters", keyNameMaxLength)
+	}
+	if !keyNameRegexp.MatchString(name) {
+		return fmt.Errorf("name must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character")
+	}
+
+	return nil
+}
+
+// normalizeKeyValues trims the whitespace around the keys and values of the
+// field's map, and validates the keys, and the values with validateValue if
+// it's set. Keys that are only distinct before trimming are duplicates.
+func normalizeKeyValues(field string, m map[string]string, validateValue func(string) error) (map[string]string, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]string, len(m))
+	for _, k := range keys {
+		key, v := strings.TrimSpace(k), strings.TrimSpace(m[k])
+		if _, ok := out[key]; ok {
+			return nil, fmt.Errorf("%s has duplicate key %q", field, key)
+		}
+
+		if err := validateKey(key); err != nil {
+			return nil, fmt.Errorf("%s key %q is invalid: %s", field, key, err)
+		}
+
+		if validateValue != nil {
+			if err := validateValue(v); err != nil {
+				return nil, fmt.Errorf("%s value %q for %s is invalid: %s", field, v, key, err)
+			}
+		}
+
+		out[key] = v
+	}
+
+	return out, nil
+}
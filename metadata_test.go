@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyValuesUnmarshal(t *testing.T) {
+	var v struct {
+		Map    keyValues `json:"map"`
+		String keyValues `json:"string"`
+	}
+
+	err := json.Unmarshal([]byte(`{"map": {"app": "web"}, "string": " app=web , tier=frontend,"}`), &v)
+	assert.NoError(t, err)
+	assert.Equal(t, keyValues{"app": "web"}, v.Map)
+	assert.Equal(t, keyValues{"app": "web", "tier": "frontend"}, v.String)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"string": "app=web,app=api"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"string": "app"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"map": ["app"]}`), &v))
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, k := range []string{"app", "app.kubernetes.io/name", "example.com/Some_Key.v1", strings.Repeat("a", 63)} {
+		assert.NoError(t, validateKey(k), k)
+	}
+
+	for _, k := range []string{"", "/app", "Example.com/app", "example.com/", "-app", "app-", "a b", strings.Repeat("a", 64), strings.Repeat("a", 254) + "/app"} {
+		assert.Error(t, validateKey(k), k)
+	}
+}
+
+func TestNormalizeKeyValues(t *testing.T) {
+	m, err := normalizeKeyValues("labels", map[string]string{" app ": " web ", "tier": "frontend"}, validateLabelValue)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "web", "tier": "frontend"}, m)
+
+	m, err = normalizeKeyValues("labels", nil, validateLabelValue)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	_, err = normalizeKeyValues("labels", map[string]string{"app": "web", "app ": "api"}, nil)
+	assert.EqualError(t, err, `labels has duplicate key "app"`)
+
+	_, err = normalizeKeyValues("labels", map[string]string{"app/": "web"}, nil)
+	assert.EqualError(t, err, `labels key "app/" is invalid: name must not be empty`)
+
+	_, err = normalizeKeyValues("labels", map[string]string{"app": "a b"}, validateLabelValue)
+	assert.Error(t, err)
+
+	_, err = normalizeKeyValues("annotations", map[string]string{"note": "a b"}, nil)
+	assert.NoError(t, err)
+}
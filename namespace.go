@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/drone/drone-plugin-go/plugin"
+)
+
+// dnsLabelRegexp matches a valid DNS-1123 label, as required for namespace names.
+var dnsLabelRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+const dnsLabelMaxLength = 63
+
+// labelValueRegexp matches a valid Kubernetes label value (excluding the empty value).
+var labelValueRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+const labelValueMaxLength = 63
+
+// validateLabelValue returns an error if v is not a valid Kubernetes label value.
+func validateLabelValue(v string) error {
+	if v == "" {
+		return nil
+	}
+
+	if len(v) > labelValueMaxLength {
+		return fmt.Errorf("must be no more than %d characters", labelValueMaxLength)
+	}
+
+	if !labelValueRegexp.MatchString(v) {
+		return fmt.Errorf("must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character")
+	}
+
+	return nil
+}
+
+// validateDNSLabel returns an error if v is not a valid DNS-1123 label.
+func validateDNSLabel(v string) error {
+	if len(v) > dnsLabelMaxLength {
+		return fmt.Errorf("must be no more than %d characters", dnsLabelMaxLength)
+	}
+
+	if !dnsLabelRegexp.MatchString(v) {
+		return fmt.Errorf("must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character")
+	}
+
+	return nil
+}
+
+// validateDNSSubdomain returns an error if v is not a valid DNS-1123
+// subdomain, as required for most object names.
+func validateDNSSubdomain(v string) error {
+	if len(v) > dnsSubdomainMaxLength {
+		return fmt.Errorf("must be no more than %d characters", dnsSubdomainMaxLength)
+	}
+
+	if !dnsSubdomainRegexp.MatchString(v) {
+		return fmt.Errorf("must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character")
+	}
+
+	return nil
+}
+
+// transformNamespace adds the prefix and suffix to the namespace. If the
+// result is too long for a namespace name, it's truncated and suffixed with a
+// hash of the full name to keep it unique.
+func transformNamespace(namespace, prefix, suffix string) (string, error) {
+	name := prefix + namespace + suffix
+
+	if len(name) > dnsLabelMaxLength {
+		sum := sha256.Sum256([]byte(name))
+		hash := hex.EncodeToString(sum[:])[:8]
+		name = strings.TrimRight(name[:dnsLabelMaxLength-len(hash)-1], "-") + "-" + hash
+	}
+
+	if err := validateDNSLabel(name); err != nil {
+		return "", fmt.Errorf("Error: namespace %q is invalid: %s\n", name, err)
+	}
+
+	return name, nil
+}
+
+// renderValues runs each value of m through the template engine with data,
+// using the left and right delimiters (the defaults if empty).
+func renderValues(m map[string]string, left, right string, data map[string]interface{}) (map[string]string, error) {
+	out := make(map[string]string, len(m))
+
+	for k, v := range m {
+		tmpl, err := template.New(k).Delims(left, right).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing value of %q: %s\n", k, err)
+		}
+
+		b := &bytes.Buffer{}
+		err = tmpl.Execute(b, data)
+		if err != nil {
+			return nil, fmt.Errorf("Error executing value of %q: %s\n", k, err)
+		}
+
+		out[k] = b.String()
+	}
+
+	return out, nil
+}
+
+// namespaceManifest builds the Namespace resource for the given name, labels and annotations.
+func namespaceManifest(name string, labels, annotations map[string]string) string {
+	b := &bytes.Buffer{}
+
+	fmt.Fprintf(b, "---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n", name)
+	writeYAMLMap(b, "labels", labels)
+	writeYAMLMap(b, "annotations", annotations)
+
+	return b.String()
+}
+
+// writeYAMLMap writes m as a sorted metadata map, quoting keys and values.
+func writeYAMLMap(b *bytes.Buffer, field string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "  %s:\n", field)
+	for _, k := range keys {
+		// JSON strings are valid YAML double-quoted scalars.
+		qk, _ := json.Marshal(k)
+		qv, _ := json.Marshal(m[k])
+		fmt.Fprintf(b, "    %s: %s\n", qk, qv)
+	}
+}
+
+// ensureNamespace creates the namespace, or updates its labels and annotations.
+func ensureNamespace(runner *Environ, vargs GKE, name string, labels, annotations map[string]string) error {
+	resource := namespaceManifest(name, labels, annotations)
+	nsPath := filepath.Join(vargs.OutputDir, fmt.Sprintf("namespace-%s.json", name))
+
+	// Write namespace resource file to tmp file to be picked up by the 'kubectl' command.
+	// This is inside the ephemeral plugin container, not on the host.
+	err := ioutil.WriteFile(nsPath, []byte(resource), 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing namespace resource file: %s\n", err)
+	}
+
+	if !vargs.KeepRendered {
+		defer removeRendered(nsPath)
+	}
+
+	// Ensure the namespace exists, without errors (unlike `kubectl create namespace`).
+	err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "apply", "--filename", nsPath)...)
+	if err != nil {
+		return fmt.Errorf("Error: %s\n", err)
+	}
+
+	return nil
+}
+
+// provenanceAnnotations returns the annotations recording the build that last
+// deployed to a namespace.
+func provenanceAnnotations(build plugin.Build) []string {
+	return []string{
+		fmt.Sprintf("drone-gke/last-build=%d", build.Number),
+		fmt.Sprintf("drone-gke/last-commit=%s", build.Commit),
+		fmt.Sprintf("drone-gke/last-branch=%s", build.Branch),
+	}
+}
+
+// annotateProvenance annotates the namespace with the build that deployed to
+// it. It only warns if the service account isn't allowed to.
+func annotateProvenance(runner *Environ, vargs GKE, namespace string, build plugin.Build) error {
+	args := append([]string{"annotate", "namespace", namespace, "--overwrite"}, provenanceAnnotations(build)...)
+
+	output := &bytes.Buffer{}
+	err := runner.WithOutput(runner.stdout, io.MultiWriter(runner.stderr, output)).Run(vargs.KubectlCmd, kubectlArgs(vargs, args...)...)
+	if err != nil && strings.Contains(output.String(), "forbidden") {
+		runner.Println("Warning: skipping namespace provenance annotations, because the service account can't annotate namespaces")
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLabelValue(t *testing.T) {
+	valid := []string{"", "a", "abc123", "my-team", "v1.2_3", "0123456789abcdef0123456789abcdef01234567"}
+	for _, v := range valid {
+		assert.NoError(t, validateLabelValue(v), v)
+	}
+
+	invalid := []string{"-a", "a-", "with space", "a/b", "x" + string(make([]byte, 63))}
+	for _, v := range invalid {
+		assert.Error(t, validateLabelValue(v), v)
+	}
+}
+
+func TestRenderValues(t *testing.T) {
+	data := map[string]interface{}{
+		"COMMIT": "abc123",
+		"TEAM":   "infra",
+	}
+
+	out, err := renderValues(map[string]string{
+		"team":   "{{.TEAM}}",
+		"commit": "{{.COMMIT}}",
+		"static": "value",
+	}, "", "", data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{
+			"team":   "infra",
+			"commit": "abc123",
+			"static": "value",
+		}, out)
+	}
+
+	_, err = renderValues(map[string]string{"missing": "{{.NOPE}}"}, "", "", data)
+	assert.Error(t, err)
+
+	out, err = renderValues(map[string]string{"team": "[[.TEAM]]", "literal": "{{.TEAM}}"}, "[[", "]]", data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"team": "infra", "literal": "{{.TEAM}}"}, out)
+	}
+}
+
+func TestNamespaceManifest(t *testing.T) {
+	assert.Equal(t, "---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: ns\n", namespaceManifest("ns", nil, nil))
+
+	expected := `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+  labels:
+    "commit": "abc123"
+    "team": "infra"
+  annotations:
+    "owner": "someone@example.com"
+`
+	assert.Equal(t, expected, namespaceManifest("ns",
+		map[string]string{"team": "infra", "commit": "abc123"},
+		map[string]string{"owner": "someone@example.com"},
+	))
+}
+
+func TestValidateDNSLabel(t *testing.T) {
+	for _, v := range []string{"a", "my-branch", "pr-123"} {
+		assert.NoError(t, validateDNSLabel(v), v)
+	}
+
+	for _, v := range []string{"", "-a", "a-", "My-Branch", "feature/x", "a.b", strings.Repeat("a", 64)} {
+		assert.Error(t, validateDNSLabel(v), v)
+	}
+}
+
+func TestValidateDNSSubdomain(t *testing.T) {
+	for _, v := range []string{"a", "gcr-pull", "pull.example.com"} {
+		assert.NoError(t, validateDNSSubdomain(v), v)
+	}
+
+	for _, v := range []string{"", "-a", "a.", "Pull", "a_b", strings.Repeat("a", 254)} {
+		assert.Error(t, validateDNSSubdomain(v), v)
+	}
+}
+
+func TestTransformNamespace(t *testing.T) {
+	ns, err := transformNamespace("feature", "", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "feature", ns)
+	}
+
+	ns, err = transformNamespace("feature", "preview-", "-app")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "preview-feature-app", ns)
+	}
+
+	long := strings.Repeat("a", 60)
+	ns, err = transformNamespace(long, "preview-", "")
+	if assert.NoError(t, err) {
+		assert.Len(t, ns, 63)
+		assert.True(t, strings.HasPrefix(ns, "preview-aaaa"))
+		assert.NoError(t, validateDNSLabel(ns))
+
+		// The hash keeps truncated names distinct.
+		other, _ := transformNamespace(long+"b", "preview-", "")
+		assert.NotEqual(t, ns, other)
+	}
+
+	_, err = transformNamespace("Feature/X", "preview-", "")
+	assert.Error(t, err)
+}
+
+func TestProvenanceAnnotations(t *testing.T) {
+	build := plugin.Build{Number: 42, Commit: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4", Branch: "main"}
+
+	assert.Equal(t, []string{
+		"drone-gke/last-build=42",
+		"drone-gke/last-commit=e3b0c44298fc1c149afbf4c8996fb92427ae41e4",
+		"drone-gke/last-branch=main",
+	}, provenanceAnnotations(build))
+}
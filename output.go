@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultOutputNameTemplate keeps the template's base name.
+const defaultOutputNameTemplate = "{{.SOURCE_NAME}}"
+
+// outputNameFuncs are available to the output name template.
+var outputNameFuncs = template.FuncMap{
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// outputName renders the output file name for the template at source. In
+// addition to data, the name template can use SOURCE_PATH (the template's
+// path) and SOURCE_NAME (its base name). The name template uses the left and
+// right delimiters, the defaults if empty.
+func outputName(nameTemplate, left, right, source string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("output_name_template").Delims(left, right).Funcs(outputNameFuncs).Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing output_name_template: %s\n", err)
+	}
+
+	nameData := make(map[string]interface{}, len(data)+2)
+	for k, v := range data {
+		nameData[k] = v
+	}
+	nameData["SOURCE_PATH"] = source
+	nameData["SOURCE_NAME"] = filepath.Base(source)
+
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, nameData)
+	if err != nil {
+		return "", fmt.Errorf("Error executing output_name_template: %s\n", err)
+	}
+
+	name := strings.TrimSpace(b.String())
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("Error: output_name_template rendered an invalid file name %q for %s\n", name, source)
+	}
+
+	return name, nil
+}
+
+// manifestHeader renders the header template, with the left and right
+// delimiters, as a YAML comment block.
+func manifestHeader(headerTemplate, left, right string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("manifest_header").Delims(left, right).Option("missingkey=error").Parse(headerTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing manifest_header: %s\n", err)
+	}
+
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("Error executing manifest_header: %s\n", err)
+	}
+
+	header := &bytes.Buffer{}
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		header.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+	}
+
+	return header.String(), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputName(t *testing.T) {
+	data := map[string]interface{}{"env": "prod"}
+
+	name, err := outputName(defaultOutputNameTemplate, "", "", "k8s/.kube.yml", data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ".kube.yml", name)
+	}
+
+	name, err = outputName(`{{.env}}-{{trimSuffix ".tmpl" .SOURCE_NAME}}`, "", "", "k8s/deployment.yml.tmpl", data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "prod-deployment.yml", name)
+	}
+
+	_, err = outputName("{{.missing}}", "", "", "a.yml", data)
+	assert.Error(t, err)
+
+	_, err = outputName("{{.SOURCE_PATH}}", "", "", "k8s/a.yml", data)
+	assert.Error(t, err)
+
+	_, err = outputName(" ", "", "", "a.yml", data)
+	assert.Error(t, err)
+
+	name, err = outputName(`[[.env]]-[[.SOURCE_NAME]]`, "[[", "]]", "k8s/deployment.yml", data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "prod-deployment.yml", name)
+	}
+}
+
+func TestManifestHeader(t *testing.T) {
+	header, err := manifestHeader("Build {{.BUILD_NUMBER}} of {{.COMMIT_SHORT}}\n\nRendered by drone-gke\n", "", "", map[string]interface{}{
+		"BUILD_NUMBER": 42,
+		"COMMIT_SHORT": "e3b0c44",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "# Build 42 of e3b0c44\n#\n# Rendered by drone-gke\n", header)
+	}
+
+	_, err = manifestHeader("{{.missing}}", "", "", map[string]interface{}{})
+	assert.Error(t, err)
+
+	header, err = manifestHeader("Build [[.BUILD_NUMBER]] {{ }}", "[[", "]]", map[string]interface{}{"BUILD_NUMBER": 42})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "# Build 42 {{ }}\n", header)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// ownedDocuments returns the documents of the given kinds.
+func ownedDocuments(docs []document, kinds []string) []document {
+	take := map[string]bool{}
+	for _, k := range kinds {
+		take[k] = true
+	}
+
+	owned := []document{}
+	for _, d := range docs {
+		if take[d.Kind] {
+			owned = append(owned, d)
+		}
+	}
+	return owned
+}
+
+// takeOwnership applies each of the objects of the take_ownership kinds with
+// a server-side apply that forces conflicts, transferring the fields other
+// field managers own to this one.
+func takeOwnership(runner *Environ, vargs GKE, docs []document) error {
+	for _, doc := range ownedDocuments(docs, vargs.TakeOwnership) {
+		f, err := ioutil.TempFile("", "ownership")
+		if err != nil {
+			return err
+		}
+
+		_, err = f.WriteString(doc.Raw)
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+
+		runner.Printf("Taking ownership of %s %q from other field managers\n", doc.Kind, doc.Name)
+
+		applyArgs := append(append([]string{"apply"}, applyFlags(vargs)...), "--force-conflicts", "--filename", f.Name())
+		err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, applyArgs...)...)
+		os.Remove(f.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnedDocuments(t *testing.T) {
+	docs, err := parseDocuments([]byte(`
+kind: Deployment
+metadata:
+  name: web
+---
+kind: Service
+metadata:
+  name: web
+---
+kind: Deployment
+metadata:
+  name: worker
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	owned := ownedDocuments(docs, []string{"Deployment"})
+	if assert.Len(t, owned, 2) {
+		assert.Equal(t, "web", owned[0].Name)
+		assert.Equal(t, "worker", owned[1].Name)
+	}
+
+	assert.Empty(t, ownedDocuments(docs, nil))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputMu serializes the lines written by the clusters deployed in parallel.
+var outputMu sync.Mutex
+
+// prefixWriter prefixes each line written to it, writing only complete lines
+// so that the output of parallel deploys doesn't interleave within lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush writes any incomplete last line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+	return err
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
+
+// deployParallel deploys to the clusters concurrently, at most limit at a
+// time. Each cluster gets its own kubeconfig and output directory, and its
+// output is prefixed with its name.
+func deployParallel(vargs GKE, clusters, namespaces []string, runner *Environ, p params, limit int) error {
+	errs := make([]error, len(clusters))
+	sem := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+
+	for i, cluster := range clusters {
+		cv := vargs
+		cv.Cluster = cluster
+		cv.Namespace = namespaces[i]
+		cv.OutputDir = filepath.Join(vargs.OutputDir, cluster)
+
+		kubeconfig := kubeconfigPath(i, cluster)
+		if vargs.UniqueContext {
+			kubeconfig = uniqueName(kubeconfig, p.build.Number)
+		}
+		defer removeKubeconfig(kubeconfig)
+
+		stdout := newPrefixWriter(os.Stdout, "["+cluster+"] ")
+		stderr := newPrefixWriter(os.Stderr, "["+cluster+"] ")
+		clusterRunner := runner.WithEnv("KUBECONFIG="+kubeconfig).WithOutput(stdout, stderr).WithLog(stdout)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs[i] = deployFanout(cv, clusterRunner, p)
+
+			stdout.Flush()
+			stderr.Flush()
+		}(i)
+	}
+
+	wg.Wait()
+
+	failures := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", clusters[i], strings.TrimSpace(err.Error())))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Error: deploys to %d of %d clusters failed:\n  %s\n", len(failures), len(clusters), strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
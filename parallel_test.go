@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	p := newPrefixWriter(b, "[dev] ")
+
+	fmt.Fprint(p, "first line\nsecond ")
+	assert.Equal(t, "[dev] first line\n", b.String())
+
+	fmt.Fprint(p, "line\nunterminated")
+	assert.Equal(t, "[dev] first line\n[dev] second line\n", b.String())
+
+	assert.NoError(t, p.Flush())
+	assert.Equal(t, "[dev] first line\n[dev] second line\n[dev] unterminated\n", b.String())
+}
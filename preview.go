@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// preview returns a unified diff between the live objects in path and the
+// objects as they would be after a server-side dry run apply. Unlike
+// `kubectl diff`, the proposed objects include any mutations made by
+// admission webhooks.
+func preview(runner *Environ, vargs GKE, path string, recursive bool) (string, error) {
+	fileArgs := []string{}
+	if recursive {
+		fileArgs = append(fileArgs, "--recursive")
+	}
+	if vargs.Namespace != "" {
+		fileArgs = append(fileArgs, "--namespace", vargs.Namespace)
+	}
+	fileArgs = append(fileArgs, "--filename", path, "--output", "yaml")
+
+	current := &bytes.Buffer{}
+	getArgs := append([]string{"get", "--ignore-not-found"}, fileArgs...)
+	err := runner.WithOutput(current, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, getArgs...)...)
+	if err != nil {
+		return "", err
+	}
+
+	proposed := &bytes.Buffer{}
+	applyArgs := append(append([]string{"apply", "--dry-run=server"}, applyFlags(vargs)...), fileArgs...)
+	err = runner.WithOutput(proposed, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, applyArgs...)...)
+	if err != nil {
+		return "", err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(current.String()),
+		B:        difflib.SplitLines(proposed.String()),
+		FromFile: fmt.Sprintf("%s (live)", path),
+		ToFile:   fmt.Sprintf("%s (proposed)", path),
+		Context:  3,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if diff == "" {
+		return fmt.Sprintf("No changes for %s\n", path), nil
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultPullSecretName is the name of the image pull secret, unless
+// pull_secret_name is set.
+const defaultPullSecretName = "drone-gke-pull-secret"
+
+// defaultPullSecretRegistries are the Container Registry hosts.
+var defaultPullSecretRegistries = []string{"gcr.io", "us.gcr.io", "eu.gcr.io", "asia.gcr.io"}
+
+// pullSecretManifest returns a kubernetes.io/dockerconfigjson Secret that
+// authenticates to the registries with the service account's JSON key, as
+// the _json_key user.
+func pullSecretManifest(name, key string, registries []string) (string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte("_json_key:" + key))
+
+	auths := map[string]interface{}{}
+	for _, r := range registries {
+		auths[r] = map[string]string{
+			"username": "_json_key",
+			"password": key,
+			"auth":     auth,
+		}
+	}
+
+	config, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		return "", err
+	}
+
+	// JSON is YAML, as far as kubectl is concerned.
+	secret, err := json.MarshalIndent(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]string{"name": name},
+		"type":       "kubernetes.io/dockerconfigjson",
+		"data":       map[string]string{".dockerconfigjson": base64.StdEncoding.EncodeToString(config)},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret) + "\n", nil
+}
+
+// applyPullSecret applies the image pull secret to the namespace. The manifest
+// holds the key, so it's only written to a private file, removed afterwards.
+func applyPullSecret(runner *Environ, vargs GKE) error {
+	manifest, err := pullSecretManifest(vargs.PullSecretName, vargs.Token, vargs.PullSecretRegistries)
+	if err != nil {
+		return fmt.Errorf("error generating the pull secret: %s", err)
+	}
+
+	path := filepath.Join(vargs.OutputDir, "pull-secret.json")
+	err = ioutil.WriteFile(path, []byte(manifest), 0600)
+	if err != nil {
+		return fmt.Errorf("error writing the pull secret: %s", err)
+	}
+	defer os.Remove(path)
+
+	return runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "apply", "--filename", path)...)
+}
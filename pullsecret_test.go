@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullSecretManifest(t *testing.T) {
+	key := `{"type": "service_account", "project_id": "p"}`
+
+	manifest, err := pullSecretManifest("pull", key, []string{"gcr.io", "us-east1-docker.pkg.dev"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	docs, err := parseDocuments([]byte(manifest))
+	if !assert.NoError(t, err) || !assert.Len(t, docs, 1) {
+		return
+	}
+	assert.Equal(t, "Secret", docs[0].Kind)
+	assert.Equal(t, "pull", docs[0].Name)
+	assert.Equal(t, "kubernetes.io/dockerconfigjson", docs[0].Object["type"])
+
+	data := docs[0].Object["data"].(map[string]interface{})
+	blob, err := base64.StdEncoding.DecodeString(data[".dockerconfigjson"].(string))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if !assert.NoError(t, json.Unmarshal(blob, &config)) {
+		return
+	}
+
+	assert.Len(t, config.Auths, 2)
+	gcr := config.Auths["gcr.io"]
+	assert.Equal(t, "_json_key", gcr.Username)
+	assert.Equal(t, key, gcr.Password)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("_json_key:"+key)), gcr.Auth)
+	assert.Equal(t, gcr, config.Auths["us-east1-docker.pkg.dev"])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+)
+
+// immutableRegexp matches kubectl's error for an object whose update changes an immutable field.
+var immutableRegexp = regexp.MustCompile(`The (\w+) "([^"]+)" is invalid: .*field is immutable`)
+
+// immutableObject identifies an object that failed to apply because of an immutable field.
+type immutableObject struct {
+	Kind string
+	Name string
+}
+
+// immutableObjects returns the objects kubectl apply reported immutable field errors for.
+func immutableObjects(output string) []immutableObject {
+	objs := []immutableObject{}
+	seen := map[immutableObject]bool{}
+
+	for _, m := range immutableRegexp.FindAllStringSubmatch(output, -1) {
+		obj := immutableObject{Kind: m[1], Name: m[2]}
+		if !seen[obj] {
+			seen[obj] = true
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs
+}
+
+// recreateImmutable replaces (deleting and recreating) each of the objects
+// from the manifests with `kubectl replace --force`. Only kinds in the
+// safelist may be recreated.
+func recreateImmutable(runner *Environ, vargs GKE, objs []immutableObject, paths []string) error {
+	safe := map[string]bool{}
+	for _, k := range vargs.RecreateKinds {
+		safe[k] = true
+	}
+
+	for _, obj := range objs {
+		if !safe[obj.Kind] {
+			return fmt.Errorf("%s %q has an immutable field change, but %s is not in recreate_kinds", obj.Kind, obj.Name, obj.Kind)
+		}
+	}
+
+	docs, err := readDocuments(paths...)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		doc, ok := findDocument(docs, obj.Kind, obj.Name)
+		if !ok {
+			return fmt.Errorf("%s %q not found in the manifests", obj.Kind, obj.Name)
+		}
+
+		f, err := ioutil.TempFile("", "recreate")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(doc.Raw)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		runner.Printf("Recreating %s %q because of an immutable field change\n", obj.Kind, obj.Name)
+
+		err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "replace", "--force", "--filename", f.Name())...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImmutableObjects(t *testing.T) {
+	output := `service "web" unchanged
+The Deployment "web" is invalid: spec.selector: Invalid value: v1.LabelSelector{MatchLabels:map[string]string{"app":"web"}}: field is immutable
+The Job "migrate" is invalid: spec.template: Invalid value: core.PodTemplateSpec{}: field is immutable
+The Deployment "web" is invalid: spec.selector: Invalid value: v1.LabelSelector{}: field is immutable
+Error from server (NotFound): namespaces "missing" not found
+`
+
+	assert.Equal(t, []immutableObject{
+		{Kind: "Deployment", Name: "web"},
+		{Kind: "Job", Name: "migrate"},
+	}, immutableObjects(output))
+
+	assert.Empty(t, immutableObjects("deployment.apps/web configured\n"))
+}
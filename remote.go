@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// remoteClient fetches remote templates.
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// errTemplateNotFound is returned when a remote template doesn't exist.
+var errTemplateNotFound = errors.New("template not found")
+
+// isRemote reports whether a template path is an http(s) URL.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// validateSHA256 checks that each template_sha256 entry is a hex SHA256 for a remote template.
+func validateSHA256(hashes map[string]string, templates ...string) error {
+	for url, sum := range hashes {
+		found := false
+		for _, t := range templates {
+			if t == url && isRemote(t) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("Error: template_sha256 has a hash for %s, which isn't a remote template\n", url)
+		}
+
+		b, err := hex.DecodeString(sum)
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("Error: template_sha256 for %s is not a hex SHA256: %q\n", url, sum)
+		}
+	}
+
+	return nil
+}
+
+// fetchTemplate downloads a remote template, verifying its SHA256 if one is given.
+func fetchTemplate(url, sum string) ([]byte, error) {
+	resp, err := remoteClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching template: %s\n", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errTemplateNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error fetching template %s: %s\n", url, resp.Status)
+	}
+
+	blob, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching template: %s\n", err)
+	}
+
+	if sum != "" {
+		actual := sha256.Sum256(blob)
+		if !strings.EqualFold(hex.EncodeToString(actual[:]), sum) {
+			return nil, fmt.Errorf("Error: template %s has SHA256 %x, expected %s\n", url, actual, sum)
+		}
+	}
+
+	return blob, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helloSHA256 is the SHA256 of "hello world".
+const helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+func TestValidateSHA256(t *testing.T) {
+	sum := helloSHA256
+
+	assert.NoError(t, validateSHA256(map[string]string{"https://example.com/kube.yml": sum}, "https://example.com/kube.yml", ".kube.sec.yml"))
+	assert.Error(t, validateSHA256(map[string]string{"https://example.com/other.yml": sum}, "https://example.com/kube.yml"))
+	assert.Error(t, validateSHA256(map[string]string{".kube.yml": sum}, ".kube.yml"))
+	assert.Error(t, validateSHA256(map[string]string{"https://example.com/kube.yml": "abc"}, "https://example.com/kube.yml"))
+}
+
+func TestFetchTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/kube.yml":
+			w.Write([]byte("hello world"))
+		case "/broken.yml":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	blob, err := fetchTemplate(server.URL+"/kube.yml", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello world", string(blob))
+	}
+
+	blob, err = fetchTemplate(server.URL+"/kube.yml", helloSHA256)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello world", string(blob))
+	}
+
+	_, err = fetchTemplate(server.URL+"/kube.yml", strings.Repeat("0", 64))
+	assert.Error(t, err)
+
+	_, err = fetchTemplate(server.URL+"/missing.yml", "")
+	assert.Equal(t, errTemplateNotFound, err)
+
+	_, err = fetchTemplate(server.URL+"/broken.yml", "")
+	assert.Error(t, err)
+}
+
+func TestIsRemote(t *testing.T) {
+	assert.True(t, isRemote("https://example.com/kube.yml"))
+	assert.True(t, isRemote("http://example.com/kube.yml"))
+	assert.False(t, isRemote(".kube.yml"))
+}
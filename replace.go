@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// isNotFound reports whether kubectl's output says an object doesn't exist.
+func isNotFound(output string) bool {
+	return strings.Contains(output, "(NotFound)")
+}
+
+// replaceManifest replaces each of the objects in the manifest file with
+// `kubectl replace`, creating those that don't exist yet.
+func replaceManifest(runner *Environ, vargs GKE, path string) error {
+	docs, err := readDocuments(path)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		f, err := ioutil.TempFile("", "replace")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(doc.Raw)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		output := &bytes.Buffer{}
+		err = runner.WithOutput(runner.stdout, io.MultiWriter(runner.stderr, output)).Run(vargs.KubectlCmd, kubectlArgs(vargs, "replace", "--filename", f.Name())...)
+		if err != nil && isNotFound(output.String()) {
+			runner.Printf("Creating %s %q, because it doesn't exist\n", doc.Kind, doc.Name)
+
+			err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "create", "--filename", f.Name())...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(`Error from server (NotFound): error when replacing "/tmp/replace123": configmaps "config" not found`))
+	assert.False(t, isNotFound(`Error from server (Conflict): error when replacing "/tmp/replace123": the object has been modified`))
+}
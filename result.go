@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result summarizes a run of the plugin, for later pipeline steps.
+type result struct {
+	Success bool          `json:"success"`
+	Error   string        `json:"error,omitempty"`
+	Phases  []phaseResult `json:"phases"`
+
+	// Changed is whether the apply changed any object, if that's known.
+	Changed *bool `json:"changed,omitempty"`
+
+	// Timings are the durations of the phases, if timing is set.
+	Timings []phaseTiming `json:"timings,omitempty"`
+	timing  bool
+
+	// mu guards Phases and Timings, which clusters deployed in parallel record to.
+	mu sync.Mutex
+}
+
+// phaseTiming is the wall-clock duration of a phase.
+type phaseTiming struct {
+	Phase   string  `json:"phase"`
+	Cluster string  `json:"cluster,omitempty"`
+	Seconds float64 `json:"seconds"`
+
+	duration time.Duration
+}
+
+// phaseResult is the exit code of a gcloud or kubectl command. The exit code
+// is -1 if the command didn't run to completion.
+type phaseResult struct {
+	Phase    string `json:"phase"`
+	Cluster  string `json:"cluster,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// record adds the exit code of a phase's command, given the error it returned.
+func (r *result) record(phase, cluster string, err error) {
+	code := 0
+	if err != nil {
+		status, ok := exitStatus(err)
+		if !ok {
+			status = -1
+		}
+		code = status
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Phases = append(r.Phases, phaseResult{Phase: phase, Cluster: cluster, ExitCode: code})
+}
+
+// startPhase starts timing a phase, if timing is set, and returns a function
+// that stops it. Only the first call of the function counts, so it can be
+// deferred, to time a phase that fails, as well as called when it finishes.
+func (r *result) startPhase(phase, cluster string) func() {
+	if !r.timing {
+		return func() {}
+	}
+
+	start := time.Now()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			d := time.Since(start) / time.Millisecond * time.Millisecond
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.Timings = append(r.Timings, phaseTiming{Phase: phase, Cluster: cluster, Seconds: d.Seconds(), duration: d})
+		})
+	}
+}
+
+// printTimings writes the duration of each phase, in the order they finished.
+func (r *result) printTimings(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintln(w, "Timing:")
+	for _, t := range r.Timings {
+		phase := t.Phase
+		if t.Cluster != "" {
+			phase += " (" + t.Cluster + ")"
+		}
+		fmt.Fprintf(w, "  %-30s %s\n", phase, t.duration)
+	}
+}
+
+// recordChanged records whether a cluster's apply changed any object. The
+// result is changed if any of the clusters' applies were.
+func (r *result) recordChanged(changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Changed == nil || changed {
+		r.Changed = &changed
+	}
+}
+
+// write writes the result as JSON to path, given the plugin's error.
+func (r *result) write(path string, err error) error {
+	r.Success = err == nil
+	if err != nil {
+		r.Error = strings.TrimSpace(err.Error())
+	}
+
+	blob, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
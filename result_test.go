@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultRecord(t *testing.T) {
+	e := NewEnviron("/tmp", []string{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	r := &result{}
+	r.record("auth", "", nil)
+	r.record("apply", "dev", e.Run("/bin/sh", "-c", "exit 2"))
+	r.record("wait", "dev", fmt.Errorf("timed out"))
+
+	assert.Equal(t, []phaseResult{
+		{Phase: "auth", ExitCode: 0},
+		{Phase: "apply", Cluster: "dev", ExitCode: 2},
+		{Phase: "wait", Cluster: "dev", ExitCode: -1},
+	}, r.Phases)
+}
+
+func TestResultTiming(t *testing.T) {
+	r := &result{}
+	r.startPhase("auth", "")()
+	assert.Empty(t, r.Timings)
+
+	r.timing = true
+	stop := r.startPhase("render", "dev")
+	time.Sleep(10 * time.Millisecond)
+	stop()
+	stop()
+
+	if assert.Len(t, r.Timings, 1) {
+		assert.Equal(t, "render", r.Timings[0].Phase)
+		assert.Equal(t, "dev", r.Timings[0].Cluster)
+		assert.True(t, r.Timings[0].Seconds >= 0.01)
+	}
+
+	r.Timings[0].Seconds, r.Timings[0].duration = 1.5, 1500*time.Millisecond
+	b := &bytes.Buffer{}
+	r.printTimings(b)
+	assert.Equal(t, "Timing:\n  render (dev)                   1.5s\n", b.String())
+}
+
+func TestResultWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "result")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "result.json")
+
+	r := &result{}
+	r.record("auth", "", nil)
+	if assert.NoError(t, r.write(path, fmt.Errorf("Error: exit status 1\n"))) {
+		blob, _ := ioutil.ReadFile(path)
+		assert.Equal(t, `{
+  "success": false,
+  "error": "Error: exit status 1",
+  "phases": [
+    {
+      "phase": "auth",
+      "exit_code": 0
+    }
+  ]
+}
+`, string(blob))
+	}
+}
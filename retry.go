@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// transientErrors are API server errors (e.g. from an overloaded GKE master)
+// that are worth retrying.
+var transientErrors = []string{
+	"etcdserver: request timed out",
+	"the server was unable to return a response in the time allotted",
+}
+
+// retryDelay is how long to wait before the first retry, and retryMaxDelay
+// the longest wait, unless retry_base and retry_max are set.
+var (
+	retryDelay    = 5 * time.Second
+	retryMaxDelay = time.Minute
+)
+
+// defaultRetryFactor is how much longer each wait is than the last.
+const defaultRetryFactor = 2.0
+
+// backoff is the wait between retries: base, multiplied by factor for each
+// retry after the first, up to max.
+type backoff struct {
+	base   time.Duration
+	max    time.Duration
+	factor float64
+}
+
+// retryBackoff returns the backoff configured by retry_base, retry_max and
+// retry_factor.
+func retryBackoff(vargs GKE) (backoff, error) {
+	b := backoff{base: retryDelay, max: retryMaxDelay, factor: defaultRetryFactor}
+
+	var err error
+	if vargs.RetryBase != "" {
+		b.base, err = time.ParseDuration(vargs.RetryBase)
+		if err != nil || b.base < 0 {
+			return b, fmt.Errorf("invalid retry_base %q", vargs.RetryBase)
+		}
+	}
+
+	if vargs.RetryMax != "" {
+		b.max, err = time.ParseDuration(vargs.RetryMax)
+		if err != nil || b.max < 0 {
+			return b, fmt.Errorf("invalid retry_max %q", vargs.RetryMax)
+		}
+	}
+
+	if vargs.RetryFactor != 0 {
+		if vargs.RetryFactor < 1 {
+			return b, fmt.Errorf("retry_factor must be at least 1, not %v", vargs.RetryFactor)
+		}
+		b.factor = vargs.RetryFactor
+	}
+
+	if b.max < b.base {
+		return b, fmt.Errorf("retry_max %s is less than retry_base %s", b.max, b.base)
+	}
+
+	return b, nil
+}
+
+// delay returns the wait before the nth retry (counting from 1), with jitter,
+// a number in [0, 1), choosing a wait between half and all of the backoff, so
+// pipelines that fail together don't all retry together.
+func (b backoff) delay(n int, jitter float64) time.Duration {
+	d := float64(b.base)
+	for i := 1; i < n && d < float64(b.max); i++ {
+		d *= b.factor
+	}
+	if d > float64(b.max) {
+		d = float64(b.max)
+	}
+
+	return time.Duration(d/2 + jitter*d/2)
+}
+
+// isTransient reports whether kubectl's output contains a transient error.
+func isTransient(output string) bool {
+	for _, e := range transientErrors {
+		if strings.Contains(output, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// modifiedError is kubectl's error when an object changed (e.g. by a
+// controller) between kubectl reading it and writing it.
+const modifiedError = "the object has been modified"
+
+// runRetrying runs a kubectl command, retrying it up to vargs.ApplyRetries
+// times if it fails with a transient error, and up to vargs.ConflictRetries
+// times if an object was modified concurrently. Other errors fail
+// immediately. Transient errors are retried with exponential backoff, while
+// conflicts are retried straight away. It returns the error output of the
+// last attempt.
+func runRetrying(runner *Environ, vargs GKE, arg ...string) (string, error) {
+	b, err := retryBackoff(vargs)
+	if err != nil {
+		return "", err
+	}
+
+	transient, modified := 0, 0
+	for {
+		output := &bytes.Buffer{}
+		err := runner.WithOutput(runner.stdout, io.MultiWriter(runner.stderr, output)).Run(vargs.KubectlCmd, kubectlArgs(vargs, arg...)...)
+		if err == nil {
+			return output.String(), nil
+		}
+
+		// Applying again reads the objects again, with their new resourceVersion.
+		if strings.Contains(output.String(), modifiedError) && modified < vargs.ConflictRetries {
+			modified++
+			runner.Printf("Retrying after an object was modified concurrently (attempt %d of %d)\n", modified, vargs.ConflictRetries)
+			continue
+		}
+
+		if transient >= vargs.ApplyRetries || !isTransient(output.String()) {
+			return output.String(), err
+		}
+
+		transient++
+		d := b.delay(transient, rand.Float64())
+		runner.Printf("Retrying in %s after transient error (attempt %d of %d)\n", d/time.Millisecond*time.Millisecond, transient, vargs.ApplyRetries)
+		time.Sleep(d)
+	}
+}
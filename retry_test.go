@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient("Error from server: etcdserver: request timed out\n"))
+	assert.True(t, isTransient("Error from server (Timeout): the server was unable to return a response in the time allotted, but may still be processing the request\n"))
+	assert.False(t, isTransient("Error from server (Forbidden): deployments.apps is forbidden\n"))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	b, err := retryBackoff(GKE{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, backoff{base: 5 * time.Second, max: time.Minute, factor: 2}, b)
+	}
+
+	b, err = retryBackoff(GKE{RetryBase: "1s", RetryMax: "10s", RetryFactor: 3})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 500*time.Millisecond, b.delay(1, 0))
+		assert.Equal(t, 750*time.Millisecond, b.delay(1, 0.5))
+		assert.Equal(t, 1500*time.Millisecond, b.delay(2, 0))
+		assert.Equal(t, 4500*time.Millisecond, b.delay(3, 0))
+		assert.Equal(t, 5*time.Second, b.delay(4, 0))
+		assert.Equal(t, 7500*time.Millisecond, b.delay(50, 0.5))
+	}
+
+	_, err = retryBackoff(GKE{RetryBase: "soon"})
+	assert.Error(t, err)
+
+	_, err = retryBackoff(GKE{RetryFactor: 0.5})
+	assert.Error(t, err)
+
+	_, err = retryBackoff(GKE{RetryBase: "2m"})
+	assert.Error(t, err)
+}
+
+func TestRunRetrying(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	// Fails with a transient error until it has been run twice.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+echo run >> runs
+if [ $(wc -l < runs) -lt 3 ]; then
+  echo "etcdserver: request timed out" >&2
+  exit 1
+fi
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	_, err = runRetrying(runner, GKE{KubectlCmd: script, ApplyRetries: 1}, "apply")
+	assert.Error(t, err)
+
+	os.Remove(filepath.Join(dir, "runs"))
+	_, err = runRetrying(runner, GKE{KubectlCmd: script, ApplyRetries: 2}, "apply")
+	assert.NoError(t, err)
+}
+
+func TestRunRetryingModified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Fails with a conflict until it has been run twice.
+	script := filepath.Join(dir, "kubectl")
+	err = ioutil.WriteFile(script, []byte(`#!/bin/sh
+echo run >> runs
+if [ $(wc -l < runs) -lt 2 ]; then
+  echo 'Error from server (Conflict): Operation cannot be fulfilled on deployments.apps "web": the object has been modified; please apply your changes to the latest version and try again' >&2
+  exit 1
+fi
+`), 0755)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	runner := NewEnviron(dir, []string{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	_, err = runRetrying(runner, GKE{KubectlCmd: script, ApplyRetries: 3}, "apply")
+	assert.Error(t, err)
+
+	os.Remove(filepath.Join(dir, "runs"))
+	_, err = runRetrying(runner, GKE{KubectlCmd: script, ConflictRetries: 1}, "apply")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rolloutKinds are the kinds `kubectl rollout status` can wait for.
+var rolloutKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+}
+
+// rolloutArgs returns the `kubectl rollout status` arguments for each of the
+// workloads in the documents.
+func rolloutArgs(docs []document, timeout string) [][]string {
+	args := [][]string{}
+	for _, d := range docs {
+		if !rolloutKinds[d.Kind] || d.Name == "" {
+			continue
+		}
+
+		a := []string{"rollout", "status", strings.ToLower(d.Kind) + "/" + d.Name, "--timeout", timeout}
+		if d.Namespace != "" {
+			a = append(a, "--namespace", d.Namespace)
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// waitRollouts waits for the rollout of each of the workloads in the
+// documents to finish.
+func waitRollouts(runner *Environ, vargs GKE, docs []document) error {
+	for _, a := range rolloutArgs(docs, vargs.RolloutTimeout) {
+		err := runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, a...)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseWaitCondition splits a wait_condition entry, like
+// `certificate/web=Ready`, into its object and condition type.
+func parseWaitCondition(entry string) (string, string, error) {
+	i := strings.LastIndex(entry, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("wait_condition %q must be like kind/name=conditionType", entry)
+	}
+
+	object, condition := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+	parts := strings.Split(object, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || condition == "" {
+		return "", "", fmt.Errorf("wait_condition %q must be like kind/name=conditionType", entry)
+	}
+
+	return object, condition, nil
+}
+
+// waitConditions waits for each of the wait_condition objects to have its
+// condition, sharing the timeout between them.
+func waitConditions(runner *Environ, vargs GKE, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for _, entry := range vargs.WaitCondition {
+		object, condition, err := parseWaitCondition(entry)
+		if err != nil {
+			return err
+		}
+
+		remaining := deadline.Sub(time.Now()) / time.Second * time.Second
+		if remaining <= 0 && !runner.printOnly {
+			return fmt.Errorf("timed out after %s waiting for %s to be %s", timeout, object, condition)
+		}
+
+		runner.Printf("Waiting for %s to be %s\n", object, condition)
+
+		err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "wait", object, "--for", "condition="+condition, "--timeout", remaining.String())...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
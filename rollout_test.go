@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutArgs(t *testing.T) {
+	docs, err := parseDocuments([]byte(`
+kind: Deployment
+metadata:
+  name: app
+---
+kind: Service
+metadata:
+  name: app
+---
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: data
+---
+kind: DaemonSet
+metadata:
+  name: agent
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, [][]string{
+		{"rollout", "status", "deployment/app", "--timeout", "5m"},
+		{"rollout", "status", "statefulset/db", "--timeout", "5m", "--namespace", "data"},
+		{"rollout", "status", "daemonset/agent", "--timeout", "5m"},
+	}, rolloutArgs(docs, "5m"))
+}
+
+func TestParseWaitCondition(t *testing.T) {
+	object, condition, err := parseWaitCondition("certificate.cert-manager.io/web=Ready")
+	assert.NoError(t, err)
+	assert.Equal(t, "certificate.cert-manager.io/web", object)
+	assert.Equal(t, "Ready", condition)
+
+	object, condition, err = parseWaitCondition(" job/migrate = Complete ")
+	assert.NoError(t, err)
+	assert.Equal(t, "job/migrate", object)
+	assert.Equal(t, "Complete", condition)
+
+	for _, entry := range []string{"web=Ready", "job/migrate", "job/migrate=", "/web=Ready", "a/b/c=Ready"} {
+		_, _, err = parseWaitCondition(entry)
+		assert.Error(t, err, entry)
+	}
+}
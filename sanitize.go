@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sanitize replaces each of the sensitive values in s.
+func sanitize(s string, sensitive []string) string {
+	values := make([]string, 0, len(sensitive))
+	for _, v := range sensitive {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	// Replace longer values first, so values containing others are fully redacted.
+	sort.Sort(sort.Reverse(byLength(values)))
+
+	for _, v := range values {
+		s = strings.Replace(s, v, redacted, -1)
+	}
+
+	return s
+}
+
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
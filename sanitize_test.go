@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	sensitive := []string{"", "pass", "password123"}
+
+	assert.Equal(t, "token: [REDACTED], other: [REDACTED]", sanitize("token: password123, other: pass", sensitive))
+	assert.Equal(t, "nothing to hide", sanitize("nothing to hide", sensitive))
+}
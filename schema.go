@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+)
+
+// schemaNode is the subset of an OpenAPI v2 schema used for validation.
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Required             []string               `json:"required"`
+	PreserveUnknown      bool                   `json:"x-kubernetes-preserve-unknown-fields"`
+	GroupVersionKind     []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// additional returns the schema of the additional properties, if it has one.
+func (n *schemaNode) additional() *schemaNode {
+	if len(n.AdditionalProperties) == 0 || n.AdditionalProperties[0] != '{' {
+		return nil
+	}
+
+	var a schemaNode
+	if json.Unmarshal(n.AdditionalProperties, &a) != nil {
+		return nil
+	}
+	return &a
+}
+
+// schemaValidator validates objects against the cluster's OpenAPI schema.
+type schemaValidator struct {
+	definitions map[string]*schemaNode
+
+	// kinds maps apiVersion and kind (e.g. apps/v1 Deployment) to definition names.
+	kinds map[string]string
+}
+
+// newSchemaValidator parses an OpenAPI v2 document, e.g. from /openapi/v2.
+func newSchemaValidator(blob []byte) (*schemaValidator, error) {
+	var doc struct {
+		Definitions map[string]*schemaNode `json:"definitions"`
+	}
+
+	err := json.Unmarshal(blob, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Definitions) == 0 {
+		return nil, fmt.Errorf("the schema has no definitions")
+	}
+
+	v := &schemaValidator{definitions: doc.Definitions, kinds: map[string]string{}}
+	for name, def := range doc.Definitions {
+		for _, gvk := range def.GroupVersionKind {
+			apiVersion := gvk.Version
+			if gvk.Group != "" {
+				apiVersion = gvk.Group + "/" + gvk.Version
+			}
+			v.kinds[apiVersion+" "+gvk.Kind] = name
+		}
+	}
+
+	return v, nil
+}
+
+// fetchSchemaValidator gets the cluster's OpenAPI schema. It returns nil if
+// the commands are only being printed.
+func fetchSchemaValidator(runner *Environ, vargs GKE) (*schemaValidator, error) {
+	out := &bytes.Buffer{}
+	err := runner.WithOutput(out, runner.stderr).Run(vargs.KubectlCmd, kubectlArgs(vargs, "get", "--raw", "/openapi/v2")...)
+	if err != nil {
+		return nil, err
+	}
+
+	if runner.printOnly {
+		return nil, nil
+	}
+
+	v, err := newSchemaValidator(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the cluster's OpenAPI schema: %s", err)
+	}
+
+	return v, nil
+}
+
+// readSchemaValidator reads a saved OpenAPI schema, e.g. the output of
+// `kubectl get --raw /openapi/v2`.
+func readSchemaValidator(path string) (*schemaValidator, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := newSchemaValidator(blob)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+
+	return v, nil
+}
+
+// validate returns the schema violations in the document, each prefixed
+// with the path of the field.
+func (v *schemaValidator) validate(doc document) []string {
+	apiVersion, _ := doc.Object["apiVersion"].(string)
+	name, ok := v.kinds[apiVersion+" "+doc.Kind]
+	if !ok {
+		return []string{fmt.Sprintf("unknown apiVersion %q and kind %q", apiVersion, doc.Kind)}
+	}
+
+	violations := []string{}
+	v.validateValue(name, v.definitions[name], doc.Object, "", &violations)
+	sort.Strings(violations)
+
+	return violations
+}
+
+func (v *schemaValidator) validateValue(defName string, node *schemaNode, value interface{}, path string, violations *[]string) {
+	if node == nil || value == nil {
+		return
+	}
+
+	for node.Ref != "" {
+		defName = strings.TrimPrefix(node.Ref, "#/definitions/")
+		node = v.definitions[defName]
+		if node == nil {
+			return
+		}
+	}
+
+	fail := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "."
+		}
+		*violations = append(*violations, p+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch node.Type {
+	case "string":
+		switch value.(type) {
+		case string:
+		case int, int64, uint64, float64:
+			// Quantities and int-or-string fields can be numbers.
+			if node.Format != "int-or-string" && !strings.HasSuffix(defName, ".Quantity") {
+				fail("expected a string, got %s", typeName(value))
+			}
+		default:
+			fail("expected a string, got %s", typeName(value))
+		}
+		return
+	case "integer":
+		switch n := value.(type) {
+		case int, int64, uint64:
+		case float64:
+			if n != math.Trunc(n) {
+				fail("expected an integer, got %s", typeName(value))
+			}
+		default:
+			fail("expected an integer, got %s", typeName(value))
+		}
+		return
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+		default:
+			fail("expected a number, got %s", typeName(value))
+		}
+		return
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected a boolean, got %s", typeName(value))
+		}
+		return
+	case "array":
+		l, ok := value.([]interface{})
+		if !ok {
+			fail("expected a list, got %s", typeName(value))
+			return
+		}
+		for i, e := range l {
+			v.validateValue("", node.Items, e, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+		return
+	}
+
+	additional := node.additional()
+	if node.Type != "object" && len(node.Properties) == 0 && additional == nil {
+		// An untyped schema allows anything.
+		return
+	}
+
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		fail("expected an object, got %s", typeName(value))
+		return
+	}
+
+	for _, r := range node.Required {
+		if _, ok := m[r]; !ok {
+			fail("missing required field %q", r)
+		}
+	}
+
+	for k, e := range m {
+		fieldPath := k
+		if path != "" {
+			fieldPath = path + "." + k
+		}
+
+		if prop, ok := node.Properties[k]; ok {
+			v.validateValue("", prop, e, fieldPath, violations)
+		} else if additional != nil {
+			v.validateValue("", additional, e, fieldPath, violations)
+		} else if len(node.Properties) > 0 && !node.PreserveUnknown {
+			fail("unknown field %q", k)
+		}
+	}
+}
+
+// typeName describes the type of a decoded YAML value.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case int, int64, uint64:
+		return "an integer"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// validateSchema validates the objects in the manifest files, returning the
+// violations, each prefixed with the file, kind and name, and field path.
+func validateSchema(v *schemaValidator, paths []string) ([]string, error) {
+	violations := []string{}
+
+	for _, path := range paths {
+		docs, err := readDocuments(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range docs {
+			for _, violation := range v.validate(d) {
+				violations = append(violations, fmt.Sprintf("%s: %s/%s: %s", path, d.Kind, d.Name, violation))
+			}
+		}
+	}
+
+	return violations, nil
+}
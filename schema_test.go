@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = []byte(`{
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "apps", "kind": "Deployment", "version": "v1"}]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "type": "object",
+      "required": ["selector"],
+      "properties": {
+        "replicas": {"type": "integer", "format": "int32"},
+        "paused": {"type": "boolean"},
+        "selector": {"type": "object", "additionalProperties": {"type": "string"}},
+        "ports": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}},
+        "cpu": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"}
+      }
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"type": "string", "format": "int-or-string"},
+    "io.k8s.apimachinery.pkg.api.resource.Quantity": {"type": "string"},
+    "io.k8s.api.core.v1.ConfigMap": {
+      "type": "object",
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+    }
+  }
+}`)
+
+func TestSchemaValidatorValidate(t *testing.T) {
+	v, err := newSchemaValidator(testSchema)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	docs, err := parseDocuments([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: web
+spec:
+  replicas: 3
+  selector:
+    app: web
+  ports: [80, http]
+  cpu: 0.5
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: broken
+  labels:
+    tier: 1
+spec:
+  replicas: "3"
+  paused: "no"
+  ports: [[80]]
+  image: nginx
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  enabled: true
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Empty(t, v.validate(docs[0]))
+	assert.Equal(t, []string{
+		"metadata.labels.tier: expected a string, got an integer",
+		"spec.paused: expected a boolean, got a string",
+		"spec.ports[0]: expected a string, got a list",
+		"spec.replicas: expected an integer, got a string",
+		"spec: missing required field \"selector\"",
+		"spec: unknown field \"image\"",
+	}, v.validate(docs[1]))
+	assert.Equal(t, []string{"data.enabled: expected a string, got a boolean"}, v.validate(docs[2]))
+	assert.Equal(t, []string{`unknown apiVersion "extensions/v1beta1" and kind "Deployment"`}, v.validate(docs[3]))
+
+	_, err = newSchemaValidator([]byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestReadSchemaValidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "openapi.json")
+	ioutil.WriteFile(path, testSchema, 0644)
+
+	v, err := readSchemaValidator(path)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, v.kinds)
+	}
+
+	_, err = readSchemaValidator(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	ioutil.WriteFile(path, []byte("not json"), 0644)
+	_, err = readSchemaValidator(path)
+	assert.Error(t, err)
+}
+
+func TestValidateSchema(t *testing.T) {
+	v, err := newSchemaValidator(testSchema)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "schema")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kube.yml")
+	ioutil.WriteFile(path, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\ndata:\n  replicas: 3\n"), 0600)
+
+	violations, err := validateSchema(v, []string{path})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{path + ": ConfigMap/config: data.replicas: expected a string, got an integer"}, violations)
+	}
+}
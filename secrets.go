@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// secretSource is a named source of secret vars.
+type secretSource struct {
+	Name   string
+	Values map[string]string
+}
+
+// mergeSecrets returns the values of each of the sources, which are in order
+// of precedence, without the keys set by an earlier source. A key set by
+// more than one source is an error, unless allowOverride is set; then the
+// overrides are returned as warnings.
+func mergeSecrets(sources []secretSource, allowOverride bool) ([]map[string]string, []string, error) {
+	merged := make([]map[string]string, len(sources))
+	overrides := []string{}
+	setBy := map[string]string{}
+
+	for i, s := range sources {
+		keys := make([]string, 0, len(s.Values))
+		for k := range s.Values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		merged[i] = map[string]string{}
+		for _, k := range keys {
+			if prev, ok := setBy[k]; ok {
+				if !allowOverride {
+					return nil, nil, fmt.Errorf("secret var %q is set in both %s and %s (set allow_secret_override to use the value from %s)", k, prev, s.Name, prev)
+				}
+
+				overrides = append(overrides, fmt.Sprintf("secret var %q from %s overrides the one from %s", k, prev, s.Name))
+				continue
+			}
+
+			setBy[k] = s.Name
+			merged[i][k] = s.Values[k]
+		}
+	}
+
+	return merged, overrides, nil
+}
+
+// readSecretFiles reads the contents of each of the secret files, relative to dir.
+func readSecretFiles(dir string, files map[string]string) (map[string]string, error) {
+	secrets := make(map[string]string, len(files))
+	for k, path := range files {
+		blob, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return nil, err
+		}
+		secrets[k] = string(blob)
+	}
+	return secrets, nil
+}
+
+// checkMaxSecrets returns an error if there are more secret vars than max,
+// unless max is 0, meaning there's no limit.
+func checkMaxSecrets(secrets, secretsBase64 map[string]string, max int) error {
+	if n := len(secrets) + len(secretsBase64); max > 0 && n > max {
+		return fmt.Errorf("%d secret vars are set, more than max_secrets %d", n, max)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeSecrets(t *testing.T) {
+	sources := []secretSource{
+		{"secrets", map[string]string{"api_key": "inline"}},
+		{"secret_files", map[string]string{"api_key": "file", "cert": "file"}},
+		{"gsm_secrets", map[string]string{"cert": "gsm", "db_password": "gsm"}},
+	}
+
+	_, _, err := mergeSecrets(sources, false)
+	assert.EqualError(t, err, `secret var "api_key" is set in both secrets and secret_files (set allow_secret_override to use the value from secrets)`)
+
+	merged, overrides, err := mergeSecrets(sources, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]string{
+		{"api_key": "inline"},
+		{"cert": "file"},
+		{"db_password": "gsm"},
+	}, merged)
+	assert.Equal(t, []string{
+		`secret var "api_key" from secrets overrides the one from secret_files`,
+		`secret var "cert" from secret_files overrides the one from gsm_secrets`,
+	}, overrides)
+
+	merged, overrides, err = mergeSecrets([]secretSource{{"secrets", nil}, {"gsm_secrets", map[string]string{"a": "b"}}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]string{{}, {"a": "b"}}, merged)
+	assert.Empty(t, overrides)
+}
+
+func TestReadSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cert.pem"), []byte("cert\n"), 0600))
+
+	secrets, err := readSecretFiles(dir, map[string]string{"cert": "cert.pem"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cert": "cert\n"}, secrets)
+
+	_, err = readSecretFiles(dir, map[string]string{"key": "key.pem"})
+	assert.Error(t, err)
+}
+
+func TestCheckMaxSecrets(t *testing.T) {
+	secrets := map[string]string{"a": "1", "b": "2"}
+	secretsBase64 := map[string]string{"c": "Mw=="}
+
+	// Equal to the limit.
+	assert.NoError(t, checkMaxSecrets(secrets, secretsBase64, 3))
+
+	// Over the limit, counting both maps.
+	assert.EqualError(t, checkMaxSecrets(secrets, secretsBase64, 2), "3 secret vars are set, more than max_secrets 2")
+	assert.EqualError(t, checkMaxSecrets(secrets, nil, 1), "2 secret vars are set, more than max_secrets 1")
+
+	// 0 is unlimited.
+	assert.NoError(t, checkMaxSecrets(secrets, secretsBase64, 0))
+	assert.NoError(t, checkMaxSecrets(nil, nil, 0))
+}
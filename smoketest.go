@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// renderSmokeTest renders the smoke test Job template to the output
+// directory, returning the rendered file's path and the Job's name.
+func renderSmokeTest(vargs GKE, inPath string, data map[string]interface{}) (string, string, error) {
+	blob, err := ioutil.ReadFile(inPath)
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading smoke test template: %s\n", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(inPath)).Delims(vargs.LeftDelim, vargs.RightDelim).Option("missingkey=" + vargs.MissingKey).Parse(string(blob))
+	if err != nil {
+		return "", "", fmt.Errorf("Error parsing smoke test template: %s\n", err)
+	}
+
+	outPath := filepath.Join(vargs.OutputDir, "smoke-test-"+filepath.Base(inPath))
+	f, err := os.Create(outPath)
+	if err != nil {
+		return "", "", fmt.Errorf("Error creating smoke test file: %s\n", err)
+	}
+	defer f.Close()
+
+	err = tmpl.Execute(f, data)
+	if err != nil {
+		return "", "", fmt.Errorf("Error executing smoke test template: %s\n", err)
+	}
+
+	docs, err := readDocuments(outPath)
+	if err != nil {
+		return "", "", fmt.Errorf("Error parsing smoke test: %s\n", err)
+	}
+
+	if len(docs) != 1 || docs[0].Kind != "Job" || docs[0].Name == "" {
+		return "", "", fmt.Errorf("Error: smoke_test_template must render a single named Job\n")
+	}
+
+	return outPath, docs[0].Name, nil
+}
+
+// runSmokeTest applies the smoke test Job, waits for it to complete, and
+// prints its logs. The Job is deleted afterwards.
+func runSmokeTest(runner *Environ, vargs GKE, path, name string) error {
+	err := runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "apply", "--filename", path)...)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "delete", "job", name, "--ignore-not-found")...)
+		if err != nil {
+			runner.Printf("Warning: error deleting smoke test Job %s: %s\n", name, err)
+		}
+	}()
+
+	waitErr := runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "wait", "--for=condition=complete", "job/"+name, "--timeout", vargs.SmokeTestTimeout)...)
+
+	err = runner.Run(vargs.KubectlCmd, kubectlArgs(vargs, "logs", "job/"+name, "--all-containers")...)
+	if err != nil {
+		runner.Printf("Warning: error getting smoke test logs: %s\n", err)
+	}
+
+	if waitErr != nil {
+		return fmt.Errorf("smoke test Job %s didn't complete within %s: %s", name, vargs.SmokeTestTimeout, waitErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderSmokeTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smoke")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	vargs := GKE{OutputDir: dir, MissingKey: "error"}
+
+	inPath := filepath.Join(dir, "smoke.yml")
+	ioutil.WriteFile(inPath, []byte("apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: smoke-{{.BUILD_NUMBER}}\n"), 0600)
+
+	outPath, name, err := renderSmokeTest(vargs, inPath, map[string]interface{}{"BUILD_NUMBER": 42})
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(dir, "smoke-test-smoke.yml"), outPath)
+		assert.Equal(t, "smoke-42", name)
+	}
+
+	ioutil.WriteFile(inPath, []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: smoke\n"), 0600)
+
+	_, _, err = renderSmokeTest(vargs, inPath, map[string]interface{}{})
+	assert.Error(t, err)
+}
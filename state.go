@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// stateMu guards the state file, which clusters deployed in parallel share.
+var stateMu sync.Mutex
+
+// commentLine matches a YAML comment line, e.g. from manifest_header.
+var commentLine = regexp.MustCompile(`(?m)^#.*\n?`)
+
+// manifestHash returns a hash of the contents of the manifest files,
+// ignoring comment lines, which don't change the objects.
+func manifestHash(paths []string) (string, error) {
+	h := sha256.New()
+
+	for _, p := range paths {
+		blob, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+		h.Write(commentLine.ReplaceAll(blob, nil))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stateKey identifies the deploy target in the state file.
+func stateKey(vargs GKE) string {
+	return strings.Join([]string{vargs.Project, vargs.Zone + vargs.Region, vargs.Cluster, vargs.Namespace}, "/")
+}
+
+// readState reads the manifest hashes of the previous deploys. A missing state file is empty.
+func readState(path string) (map[string]string, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	return loadState(path)
+}
+
+func loadState(path string) (map[string]string, error) {
+	state := map[string]string{}
+
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(blob, &state)
+	return state, err
+}
+
+// writeState records the manifest hash for the deploy target in the state file.
+func writeState(path, key, hash string) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	state, err := loadState(path)
+	if err != nil {
+		return err
+	}
+
+	state[key] = hash
+
+	blob, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.yml")
+	ioutil.WriteFile(a, []byte("kind: ConfigMap\n"), 0644)
+
+	h1, err := manifestHash([]string{a})
+	assert.NoError(t, err)
+
+	h2, err := manifestHash([]string{a})
+	assert.NoError(t, err)
+	assert.Equal(t, h1, h2)
+
+	ioutil.WriteFile(a, []byte("# Rendered at 2017-06-01T12:00:00Z\nkind: ConfigMap\n"), 0644)
+	h2, err = manifestHash([]string{a})
+	assert.NoError(t, err)
+	assert.Equal(t, h1, h2)
+
+	ioutil.WriteFile(a, []byte("kind: Secret\n"), 0644)
+	h3, err := manifestHash([]string{a})
+	assert.NoError(t, err)
+	assert.NotEqual(t, h1, h3)
+
+	_, err = manifestHash([]string{filepath.Join(dir, "missing.yml")})
+	assert.Error(t, err)
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+
+	state, err := readState(path)
+	if assert.NoError(t, err) {
+		assert.Empty(t, state)
+	}
+
+	key := stateKey(GKE{Project: "p", Zone: "z", Cluster: "c", Namespace: "n"})
+	assert.Equal(t, "p/z/c/n", key)
+
+	assert.NoError(t, writeState(path, key, "abc"))
+	assert.NoError(t, writeState(path, "other", "def"))
+
+	state, err = readState(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"p/z/c/n": "abc", "other": "def"}, state)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// target holds the cluster coordinates of a named deploy environment.
+type target struct {
+	Project   string `yaml:"project"`
+	Zone      string `yaml:"zone"`
+	Region    string `yaml:"region"`
+	Cluster   string `yaml:"cluster"`
+	Namespace string `yaml:"namespace"`
+}
+
+// loadTarget reads the named target from a YAML file of targets keyed by name.
+func loadTarget(path, name string) (target, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return target{}, fmt.Errorf("Error reading target file: %s\n", err)
+	}
+
+	targets := map[string]target{}
+	err = yaml.Unmarshal(blob, &targets)
+	if err != nil {
+		return target{}, fmt.Errorf("Error parsing target file: %s\n", err)
+	}
+
+	t, ok := targets[name]
+	if !ok {
+		return target{}, fmt.Errorf("Error: target %q not found in target file\n", name)
+	}
+
+	return t, nil
+}
+
+// applyTarget fills the coordinates that weren't explicitly set in vargs from t.
+func applyTarget(vargs *GKE, t target) {
+	if vargs.Project == "" {
+		vargs.Project = t.Project
+	}
+
+	// Explicitly setting either location overrides both from the target.
+	if vargs.Zone == "" && vargs.Region == "" {
+		vargs.Zone = t.Zone
+		vargs.Region = t.Region
+	}
+
+	if vargs.Cluster == "" {
+		vargs.Cluster = t.Cluster
+	}
+
+	if vargs.Namespace == "" {
+		vargs.Namespace = t.Namespace
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTarget(t *testing.T) {
+	f, err := ioutil.TempFile("", "targets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`
+staging:
+  project: my-project
+  zone: us-east1-b
+  cluster: staging
+production:
+  project: my-project
+  region: us-east1
+  cluster: production
+  namespace: prod
+`)
+	f.Close()
+
+	tgt, err := loadTarget(f.Name(), "production")
+	if assert.NoError(t, err) {
+		assert.Equal(t, target{Project: "my-project", Region: "us-east1", Cluster: "production", Namespace: "prod"}, tgt)
+	}
+
+	_, err = loadTarget(f.Name(), "development")
+	assert.Error(t, err)
+}
+
+func TestApplyTarget(t *testing.T) {
+	tgt := target{Project: "p", Zone: "z", Cluster: "c", Namespace: "n"}
+
+	vargs := GKE{}
+	applyTarget(&vargs, tgt)
+	assert.Equal(t, GKE{Project: "p", Zone: "z", Cluster: "c", Namespace: "n"}, vargs)
+
+	vargs = GKE{Region: "r", Cluster: "other"}
+	applyTarget(&vargs, tgt)
+	assert.Equal(t, GKE{Project: "p", Region: "r", Cluster: "other", Namespace: "n"}, vargs)
+}
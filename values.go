@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadValues reads the vars for an environment from <dir>/<environment>.yaml.
+// It returns nil if the file doesn't exist.
+func loadValues(dir, environment string) (map[string]interface{}, error) {
+	path := filepath.Join(dir, environment+".yaml")
+
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading values file: %s\n", err)
+	}
+
+	var values interface{}
+	err = yaml.Unmarshal(blob, &values)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing values file %s: %s\n", path, err)
+	}
+
+	if values == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	m, ok := normalizeYAML(values).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Error parsing values file %s: expected a map of vars\n", path)
+	}
+
+	return m, nil
+}
+
+// mergeValues returns the vars, with the values as defaults for any that aren't set.
+func mergeValues(vars, values map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(vars)+len(values))
+	for k, v := range values {
+		merged[k] = v
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	return merged
+}
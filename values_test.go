@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "production.yaml"), []byte("replicas: 3\nlimits:\n  cpu: 500m\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("- not\n- a map\n"), 0644)
+
+	values, err := loadValues(dir, "production")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"replicas": 3,
+			"limits":   map[string]interface{}{"cpu": "500m"},
+		}, values)
+	}
+
+	values, err = loadValues(dir, "staging")
+	if assert.NoError(t, err) {
+		assert.Nil(t, values)
+	}
+
+	_, err = loadValues(dir, "broken")
+	assert.Error(t, err)
+}
+
+func TestMergeValues(t *testing.T) {
+	merged := mergeValues(
+		map[string]interface{}{"replicas": 5, "app": "web"},
+		map[string]interface{}{"replicas": 3, "env": "prod"},
+	)
+
+	assert.Equal(t, map[string]interface{}{"replicas": 5, "app": "web", "env": "prod"}, merged)
+
+	// vars_defaults are merged in last, under vars and the values file.
+	merged = mergeValues(merged, map[string]interface{}{"replicas": 1, "debug": false})
+	assert.Equal(t, map[string]interface{}{"replicas": 5, "app": "web", "env": "prod", "debug": false}, merged)
+}